@@ -0,0 +1,49 @@
+package blizzard
+
+import (
+	"context"
+	"fmt"
+)
+
+// CharacterAchievement is an achievement a character has earned or is working towards
+type CharacterAchievement struct {
+	ID          int `json:"id"`
+	Achievement struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"achievement"`
+	// CompletedTimestamp is in milliseconds since the epoch, or 0 while in progress
+	CompletedTimestamp int64 `json:"completed_timestamp"`
+}
+
+// CharacterAchievements lists a character's achievements
+type CharacterAchievements struct {
+	TotalQuantity int                    `json:"total_quantity"`
+	TotalPoints   int                    `json:"total_points"`
+	Achievements  []CharacterAchievement `json:"achievements"`
+}
+
+// Completed reports whether the character has earned the achievement with the given ID
+func (a *CharacterAchievements) Completed(id int) bool {
+	for _, achievement := range a.Achievements {
+		if achievement.ID == id {
+			return achievement.CompletedTimestamp > 0
+		}
+	}
+	return false
+}
+
+// GetCharacterAchievements returns the achievements of a character.
+// ErrCharacterNotFound is returned if the character does not exist.
+func (c *BlizzardClient) GetCharacterAchievements(ctx context.Context, characterName, realm string) (*CharacterAchievements, error) {
+	path, err := c.characterPath(ctx, characterName, realm, "/achievements")
+	if err != nil {
+		return nil, err
+	}
+
+	var achievements CharacterAchievements
+	if err := c.getJSON(ctx, EndpointAchievements, path, ErrCharacterNotFound, &achievements); err != nil {
+		return nil, fmt.Errorf("failed to get character achievements: %w", err)
+	}
+	return &achievements, nil
+}
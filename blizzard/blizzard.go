@@ -3,7 +3,9 @@
 package blizzard
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,14 +20,22 @@ import (
 type BlizzardClient struct {
 	ClientID     string
 	ClientSecret string
-	accessToken  string
-	tokenExpiry  time.Time
-}
-
-type tokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+	Region       Region
+	httpClient   *http.Client
+	oauthURL     string
+	apiBaseURL   string
+	tokens       *tokenProvider
+	executor     *requestExecutor
+	cache        *responseCache
+	realms       *realmResolver
+	// localeOverride replaces the region's default locale when set
+	localeOverride string
+
+	retry          retryPolicy
+	perSecondLimit int
+	hourlyLimit    int
+	cacheTTLs      map[Endpoint]time.Duration
+	cacheStore     CacheStore
 }
 
 type CharacterSummary struct {
@@ -37,7 +47,19 @@ type CharacterSummary struct {
 		Type string `json:"type"`
 		Name string `json:"name"`
 	} `json:"gender"`
-	GuildRank int `json:"guild_rank"`
+	Faction struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"faction"`
+	Race           PlayableRace  `json:"race"`
+	CharacterClass PlayableClass `json:"character_class"`
+	ActiveSpec     struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"active_spec"`
+	GuildRank         int `json:"guild_rank"`
+	AverageItemLevel  int `json:"average_item_level"`
+	EquippedItemLevel int `json:"equipped_item_level"`
 }
 
 type Guild struct {
@@ -76,143 +98,180 @@ type GuildMember struct {
 	Rank int `json:"rank"`
 }
 
-// GuildRoster represents the full guild roster response
-type GuildRoster struct {
-	Members []struct {
-		Character struct {
-			Name  string `json:"name"`
-			Realm struct {
-				Name string `json:"name"`
-				ID   int    `json:"id"`
-				Slug string `json:"slug"`
-			} `json:"realm"`
-		} `json:"character"`
-		Rank int `json:"rank"`
-	} `json:"members"`
+func NewBlizzardClient(clientID, clientSecret string, region Region, opts ...Option) *BlizzardClient {
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Initializing Blizzard API client with client ID: %s (region %s)", clientID, region)
+	}
+	c := &BlizzardClient{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		Region:         region,
+		httpClient:     newDefaultHTTPClient(),
+		oauthURL:       region.OAuthURL(),
+		apiBaseURL:     region.APIBaseURL(),
+		retry:          defaultRetryPolicy,
+		perSecondLimit: DefaultPerSecondLimit,
+		hourlyLimit:    DefaultHourlyLimit,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.tokens = newTokenProvider(clientID, clientSecret, c.oauthURL, c.httpClient)
+	c.executor = newRequestExecutor(c.httpClient, c.retry, c.perSecondLimit, c.hourlyLimit)
+	c.cache = newResponseCache(c.cacheTTLs, c.cacheStore)
+	c.realms = &realmResolver{refreshTTL: c.cache.ttl(EndpointRealmIndex)}
+	return c
 }
 
-func NewBlizzardClient(clientID, clientSecret string) *BlizzardClient {
-	if util.IsDebugEnabled() {
-		util.Logger.Printf("Initializing Blizzard API client with client ID: %s", clientID)
-	}
-	return &BlizzardClient{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-	}
+// QuotaUsage returns how much of the Blizzard API quota the client has used
+func (c *BlizzardClient) QuotaUsage() QuotaUsage {
+	return c.executor.Usage()
 }
 
-func (c *BlizzardClient) getAccessToken() error {
-	if c.accessToken != "" && time.Now().Before(c.tokenExpiry) {
-		util.Logger.Printf("Using existing access token (expires in %v)", c.tokenExpiry.Sub(time.Now()))
-		return nil
+// locale returns the configured locale, falling back to the region default
+func (c *BlizzardClient) locale() string {
+	if c.localeOverride != "" {
+		return c.localeOverride
 	}
+	return c.Region.DefaultLocale()
+}
 
-	util.Logger.Print("Getting new Blizzard API access token")
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
+// apiURL builds a full API URL for the given path in the given namespace kind (profile, dynamic or static)
+func (c *BlizzardClient) apiURL(path, namespaceKind string) string {
+	params := url.Values{}
+	params.Add("namespace", c.Region.Namespace(namespaceKind))
+	params.Add("locale", c.locale())
+	return fmt.Sprintf("%s%s?%s", strings.TrimSuffix(c.apiBaseURL, "/"), path, params.Encode())
+}
 
-	req, err := http.NewRequest("POST", "https://us.battle.net/oauth/token", strings.NewReader(data.Encode()))
-	if err != nil {
-		return fmt.Errorf("failed to create token request: %v", err)
+// apiResponse is the status, headers and body of an API response
+type apiResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// send performs an authenticated GET request with the given extra headers. If the API
+// rejects the access token, the token is invalidated and the request retried once.
+func (c *BlizzardClient) send(ctx context.Context, fullURL string, header http.Header) (*apiResponse, error) {
+	resp, token, err := c.doGet(ctx, fullURL, header)
+	if err != nil || resp.status != http.StatusUnauthorized {
+		return resp, err
 	}
 
-	req.SetBasicAuth(c.ClientID, c.ClientSecret)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	util.Logger.Printf("API rejected access token for %s, retrying with a new token", fullURL)
+	c.tokens.Invalidate(token)
+	resp, _, err = c.doGet(ctx, fullURL, header)
+	return resp, err
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *BlizzardClient) doGet(ctx context.Context, fullURL string, header http.Header) (*apiResponse, string, error) {
+	token, err := c.tokens.Token(ctx)
 	if err != nil {
-		util.Logger.Printf("Error getting access token: %v", err)
-		return fmt.Errorf("failed to get token: %v", err)
+		return nil, "", fmt.Errorf("failed to get access token: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
 	if err != nil {
-		util.Logger.Printf("Error reading token response: %v", err)
-		return fmt.Errorf("failed to read token response: %v", err)
+		return nil, token, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	var token tokenResponse
-	if err := json.Unmarshal(body, &token); err != nil {
-		util.Logger.Printf("Error parsing token response: %v\nResponse body: %s", err, string(body))
-		return fmt.Errorf("failed to parse token response: %v", err)
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
 	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Accept", "application/json")
 
-	c.accessToken = token.AccessToken
-	c.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn-60) * time.Second)
-	util.Logger.Printf("Successfully obtained new access token (expires in %d seconds)", token.ExpiresIn)
-	return nil
-}
-
-func (c *BlizzardClient) GetCharacterGuild(characterName, realm string) (*Guild, error) {
-	util.Logger.Printf("Looking up character %s on realm %s", characterName, realm)
+	resp, err := c.executor.Do(req)
+	if err != nil {
+		return nil, token, err
+	}
+	defer resp.Body.Close()
 
-	if err := c.getAccessToken(); err != nil {
-		util.Logger.Printf("Failed to get access token: %v", err)
-		return nil, err
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, token, fmt.Errorf("failed to read response: %w", err)
 	}
+	return &apiResponse{status: resp.StatusCode, header: resp.Header, body: body}, token, nil
+}
 
-	// Convert realm name to slug format (lowercase, spaces to hyphens)
-	realmSlug := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(realm), " ", "-"))
+// characterPath builds the path of a character profile resource, e.g. "/equipment".
+// An empty suffix selects the character profile summary. The realm is resolved through
+// the realm index, so a RealmNotFoundError is returned for unknown realms.
+func (c *BlizzardClient) characterPath(ctx context.Context, characterName, realm, suffix string) (string, error) {
 	characterNameLower := strings.ToLower(strings.TrimSpace(characterName))
-
-	// Validate inputs
-	if realmSlug == "" || characterNameLower == "" {
+	if strings.TrimSpace(realm) == "" || characterNameLower == "" {
 		util.Logger.Printf("Invalid input: realm='%s' character='%s'", realm, characterName)
-		return nil, fmt.Errorf("realm and character name cannot be empty")
+		return "", fmt.Errorf("realm and character name cannot be empty")
 	}
-
-	// Build URL for character profile
-	baseURL := "https://us.api.blizzard.com"
-	path := fmt.Sprintf("/profile/wow/character/%s/%s", url.PathEscape(realmSlug), url.PathEscape(characterNameLower))
-	params := url.Values{}
-	params.Add("namespace", "profile-us")
-	params.Add("locale", "en_US")
-
-	fullURL := fmt.Sprintf("%s%s?%s", baseURL, path, params.Encode())
-
-	util.Logger.Printf("Making character profile request to: %s", fullURL)
-
-	req, err := http.NewRequest("GET", fullURL, nil)
+	realmSlug, err := c.realmSlug(ctx, realm)
 	if err != nil {
-		util.Logger.Printf("Error creating request: %v", err)
-		return nil, fmt.Errorf("failed to create character request: %v", err)
+		return "", err
 	}
+	return fmt.Sprintf("/profile/wow/character/%s/%s%s", url.PathEscape(realmSlug), url.PathEscape(characterNameLower), suffix), nil
+}
 
-	req.Header.Add("Authorization", "Bearer "+c.accessToken)
-	req.Header.Add("Accept", "application/json")
+// getJSON fetches a profile namespace resource through the cache and decodes it into v.
+// A 404 response is reported as an APIError wrapping notFound.
+func (c *BlizzardClient) getJSON(ctx context.Context, endpoint Endpoint, path string, notFound error, v interface{}) error {
+	return c.getNamespacedJSON(ctx, endpoint, "profile", path, notFound, v)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		util.Logger.Printf("Error making request: %v", err)
-		return nil, fmt.Errorf("failed to get character info: %v", err)
+// getNamespacedJSON is getJSON for a resource in the given namespace kind (profile,
+// dynamic or static)
+func (c *BlizzardClient) getNamespacedJSON(ctx context.Context, endpoint Endpoint, namespaceKind, path string, notFound error, v interface{}) error {
+	fullURL := c.apiURL(path, namespaceKind)
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Making %s request to: %s", endpoint, fullURL)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	status, body, err := c.getCached(ctx, endpoint, fullURL)
 	if err != nil {
-		util.Logger.Printf("Error reading response body: %v", err)
-		return nil, fmt.Errorf("failed to read character response: %v", err)
+		return err
+	}
+	if status == 404 {
+		return newAPIError(status, path, notFound)
+	}
+	if status != 200 {
+		util.Logger.Printf("API request failed with status %d. Response body: %s", status, string(body))
+		return newAPIError(status, path, nil)
 	}
 
-	util.Logger.Printf("Character API response status: %d", resp.StatusCode)
-
-	if resp.StatusCode == 404 {
-		util.Logger.Printf("Character %s on realm %s not found", characterName, realm)
-		return nil, nil
+	if err := json.Unmarshal(body, v); err != nil {
+		util.Logger.Printf("Error parsing %s response: %v", endpoint, err)
+		return fmt.Errorf("failed to parse %s response: %w", endpoint, err)
 	}
+	return nil
+}
 
-	if resp.StatusCode != 200 {
-		util.Logger.Printf("API request failed with status %d. Response body: %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+// GetCharacterSummary returns a character's profile summary. ErrCharacterNotFound is
+// returned if the character does not exist.
+func (c *BlizzardClient) GetCharacterSummary(ctx context.Context, characterName, realm string) (*CharacterSummary, error) {
+	util.Logger.Printf("Looking up character %s on realm %s", characterName, realm)
+
+	path, err := c.characterPath(ctx, characterName, realm, "")
+	if err != nil {
+		return nil, err
 	}
 
 	var character CharacterSummary
-	if err := json.Unmarshal(body, &character); err != nil {
-		util.Logger.Printf("Error parsing character response: %v\nResponse body: %s", err, string(body))
-		return nil, fmt.Errorf("failed to parse character response: %v", err)
+	if err := c.getJSON(ctx, EndpointCharacterProfile, path, ErrCharacterNotFound, &character); err != nil {
+		if errors.Is(err, ErrCharacterNotFound) {
+			util.Logger.Printf("Character %s on realm %s not found", characterName, realm)
+		}
+		return nil, fmt.Errorf("failed to get character info: %w", err)
+	}
+	return &character, nil
+}
+
+// GetCharacterGuild returns the guild a character belongs to, or nil if the character
+// is not in a guild. ErrCharacterNotFound is returned if the character does not exist.
+func (c *BlizzardClient) GetCharacterGuild(ctx context.Context, characterName, realm string) (*Guild, error) {
+	character, err := c.GetCharacterSummary(ctx, characterName, realm)
+	if err != nil {
+		return nil, err
 	}
 
 	if character.Guild.Name == "" {
@@ -224,104 +283,39 @@ func (c *BlizzardClient) GetCharacterGuild(characterName, realm string) (*Guild,
 	return &character.Guild, nil
 }
 
-func (c *BlizzardClient) GetGuildMemberInfo(characterName, realmSlug, guildName string) (*GuildMember, error) {
-	if err := c.getAccessToken(); err != nil {
-		util.Logger.Printf("Failed to get access token: %v", err)
-		return nil, err
-	}
-
-	// Clean up guild name for URL (lowercase, spaces to hyphens)
-	guildSlug := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(guildName), " ", "-"))
-
-	// Build URL for guild roster
-	baseURL := "https://us.api.blizzard.com"
-	path := fmt.Sprintf("/data/wow/guild/%s/%s/roster", url.PathEscape(realmSlug), url.PathEscape(guildSlug))
-	params := url.Values{}
-	params.Add("namespace", "profile-us")
-	params.Add("locale", "en_US")
-
-	fullURL := fmt.Sprintf("%s%s?%s", baseURL, path, params.Encode())
-
-	if util.IsDebugEnabled() {
-		util.Logger.Printf("Making guild roster request to: %s", fullURL)
-		util.Logger.Printf("Debug info - Realm slug: %s, Guild slug: %s", realmSlug, guildSlug)
-	}
-
-	req, err := http.NewRequest("GET", fullURL, nil)
+// GetGuildMemberInfo looks up a character in a guild's roster. ErrGuildNotFound is returned
+// if the guild does not exist and ErrNotGuildMember if the character is not on the roster.
+func (c *BlizzardClient) GetGuildMemberInfo(ctx context.Context, characterName, realmSlug, guildName string) (*GuildMember, error) {
+	roster, err := c.GetGuildRoster(ctx, realmSlug, slugify(guildName))
 	if err != nil {
-		util.Logger.Printf("Error creating request: %v", err)
-		return nil, fmt.Errorf("failed to create guild roster request: %v", err)
-	}
-
-	req.Header.Add("Authorization", "Bearer "+c.accessToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		util.Logger.Printf("Error making request: %v", err)
-		return nil, fmt.Errorf("failed to get guild roster: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.Logger.Printf("Error reading response body: %v", err)
-		return nil, fmt.Errorf("failed to read guild roster response: %v", err)
-	}
-
-	if resp.StatusCode != 200 {
-		if util.IsDebugEnabled() {
-			util.Logger.Printf("API request failed with status %d. Response body: %s", resp.StatusCode, string(body))
-		}
-		if resp.StatusCode == 404 {
-			util.Logger.Printf("Guild not found: realm=%s, guild=%s", realmSlug, guildSlug)
-			return nil, fmt.Errorf("guild not found on realm")
-		}
-		return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+		return nil, err
 	}
 
-	var roster GuildRoster
-	if err := json.Unmarshal(body, &roster); err != nil {
-		util.Logger.Printf("Error parsing guild roster response: %v", err)
+	// Find the specific character in the roster
+	member := roster.FindMember(characterName, "")
+	if member == nil {
 		if util.IsDebugEnabled() {
-			util.Logger.Printf("Response body: %s", string(body))
+			util.Logger.Printf("Character %s not found in guild roster", characterName)
 		}
-		return nil, fmt.Errorf("failed to parse guild roster response: %v", err)
+		return nil, ErrNotGuildMember
 	}
 
 	if util.IsDebugEnabled() {
-		util.Logger.Printf("Guild roster response - Members count: %d", len(roster.Members))
-	}
-
-	// Find the specific character in the roster
-	characterNameLower := strings.ToLower(characterName)
-	var foundMember *GuildMember
-	for _, member := range roster.Members {
-		if strings.ToLower(member.Character.Name) == characterNameLower {
-			guildMember := &GuildMember{
-				Rank: member.Rank,
-			}
-			guildMember.Character.Name = member.Character.Name
-			guildMember.Character.Realm = member.Character.Realm
-			foundMember = guildMember
-			if util.IsDebugEnabled() {
-				util.Logger.Printf("Found character %s in roster with rank %d", characterName, member.Rank)
-			}
-			break
-		}
+		util.Logger.Printf("Found character %s in roster with rank %d", characterName, member.Rank)
 	}
 
-	if foundMember == nil && util.IsDebugEnabled() {
-		util.Logger.Printf("Character %s not found in guild roster", characterName)
+	guildMember := &GuildMember{
+		Rank: member.Rank,
 	}
-
-	return foundMember, nil
+	guildMember.Character.Name = member.Character.Name
+	guildMember.Character.Realm = member.Character.Realm
+	return guildMember, nil
 }
 
-// GetGuildInfo returns simplified guild information for a character
-func (c *BlizzardClient) GetGuildInfo(characterName, realm string) (*GuildInfo, error) {
-	guild, err := c.GetCharacterGuild(characterName, realm)
+// GetGuildInfo returns simplified guild information for a character, or nil if the
+// character is not in a guild. The rank is -1 if it could not be determined.
+func (c *BlizzardClient) GetGuildInfo(ctx context.Context, characterName, realm string) (*GuildInfo, error) {
+	guild, err := c.GetCharacterGuild(ctx, characterName, realm)
 	if err != nil {
 		return nil, err
 	}
@@ -333,26 +327,24 @@ func (c *BlizzardClient) GetGuildInfo(characterName, realm string) (*GuildInfo,
 	guildRealmSlug := guild.Realm.Slug
 	if guildRealmSlug == "" {
 		// Fallback to converting realm name if slug is not provided
-		guildRealmSlug = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(guild.Realm.Name), " ", "-"))
+		guildRealmSlug = slugify(guild.Realm.Name)
 	}
 
 	// Get member info to get the rank
-	member, err := c.GetGuildMemberInfo(characterName, guildRealmSlug, guild.Name)
-	if err != nil {
-		util.Logger.Printf("Failed to get guild member info: %v", err)
-		// Continue with unknown rank
-		return &GuildInfo{
-			Name:    guild.Name,
-			Rank:    -1,
-			Faction: guild.Faction.Name,
-		}, nil
-	}
-
 	rank := -1
-	if member != nil {
+	member, err := c.GetGuildMemberInfo(ctx, characterName, guildRealmSlug, guild.Name)
+	switch {
+	case err == nil:
 		rank = member.Rank
-	} else if util.IsDebugEnabled() {
-		util.Logger.Printf("Member info not found for character %s", characterName)
+	case ctx.Err() != nil:
+		return nil, err
+	case errors.Is(err, ErrNotGuildMember):
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Member info not found for character %s", characterName)
+		}
+	default:
+		// Continue with unknown rank
+		util.Logger.Printf("Failed to get guild member info: %v", err)
 	}
 
 	return &GuildInfo{
@@ -363,11 +355,11 @@ func (c *BlizzardClient) GetGuildInfo(characterName, realm string) (*GuildInfo,
 }
 
 // IsCharacterInGuild checks if a character is in a specific guild by ID
-func (c *BlizzardClient) IsCharacterInGuild(characterName, realm string, guildID int) (bool, error) {
+func (c *BlizzardClient) IsCharacterInGuild(ctx context.Context, characterName, realm string, guildID int) (bool, error) {
 	// First get the character's guild info
-	guild, err := c.GetCharacterGuild(characterName, realm)
+	guild, err := c.GetCharacterGuild(ctx, characterName, realm)
 	if err != nil {
-		return false, fmt.Errorf("failed to get character guild info: %v", err)
+		return false, fmt.Errorf("failed to get character guild info: %w", err)
 	}
 
 	if guild == nil {
@@ -392,52 +384,31 @@ func (c *BlizzardClient) IsCharacterInGuild(characterName, realm string, guildID
 }
 
 // CharacterExists checks if a character exists on the specified realm
-func (c *BlizzardClient) CharacterExists(characterName, realm string) (bool, error) {
-	if err := c.getAccessToken(); err != nil {
-		return false, fmt.Errorf("failed to get access token: %v", err)
+func (c *BlizzardClient) CharacterExists(ctx context.Context, characterName, realm string) (bool, error) {
+	path, err := c.characterPath(ctx, characterName, realm, "")
+	if err != nil {
+		return false, err
 	}
-
-	// Convert realm name to slug format
-	realmSlug := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(realm), " ", "-"))
-	characterNameLower := strings.ToLower(strings.TrimSpace(characterName))
-
-	// Build URL for character profile
-	baseURL := "https://us.api.blizzard.com"
-	path := fmt.Sprintf("/profile/wow/character/%s/%s", url.PathEscape(realmSlug), url.PathEscape(characterNameLower))
-	params := url.Values{}
-	params.Add("namespace", "profile-us")
-	params.Add("locale", "en_US")
-
-	fullURL := fmt.Sprintf("%s%s?%s", baseURL, path, params.Encode())
+	fullURL := c.apiURL(path, "profile")
 
 	if util.IsDebugEnabled() {
 		util.Logger.Printf("Checking character existence: %s", fullURL)
 	}
 
-	req, err := http.NewRequest("GET", fullURL, nil)
+	status, _, err := c.getCached(ctx, EndpointCharacterProfile, fullURL)
 	if err != nil {
-		return false, fmt.Errorf("failed to create character request: %v", err)
+		return false, fmt.Errorf("failed to check character: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.accessToken)
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to check character: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
+	if status == 404 {
 		if util.IsDebugEnabled() {
 			util.Logger.Printf("Character %s on realm %s not found", characterName, realm)
 		}
 		return false, nil
 	}
 
-	if resp.StatusCode != 200 {
-		return false, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+	if status != 200 {
+		return false, newAPIError(status, path, nil)
 	}
 
 	return true, nil
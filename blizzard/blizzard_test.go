@@ -0,0 +1,828 @@
+package blizzard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+func init() {
+	// Initialize the util logger for tests
+	util.Logger = log.New(os.Stdout, "TEST: ", log.LstdFlags)
+}
+
+// testRealmIndex is the realm index served by the stand-in server
+const testRealmIndex = `{"realms": [
+	{"name": "Cenarius", "id": 1, "slug": "cenarius"},
+	{"name": "Area 52", "id": 2, "slug": "area-52"},
+	{"name": "Mal'Ganis", "id": 3, "slug": "malganis"},
+	{"name": "Aerie Peak", "id": 4, "slug": "aerie-peak"},
+	{"name": "Kel'Thuzad", "id": 5, "slug": "kelthuzad"},
+	{"name": "Aggra (Português)", "id": 6, "slug": "aggra-portugues"}
+]}`
+
+// newStandInServer starts a local server that answers the OAuth endpoint and
+// delegates every other request to the given API handler
+func newStandInServer(t *testing.T, api http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "test-id" || secret != "test-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", TokenType: "bearer", ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/data/wow/realm/index", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRealmIndex))
+	})
+	mux.HandleFunc("/data/wow/mythic-keystone/season/index", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"seasons": [{"id": 12}, {"id": 13}], "current_season": {"id": 13}}`))
+	})
+	mux.HandleFunc("/", api)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(server *httptest.Server, region Region) *BlizzardClient {
+	return NewBlizzardClient("test-id", "test-secret", region,
+		WithHTTPClient(server.Client()),
+		WithOAuthURL(server.URL+"/oauth/token"),
+		WithAPIBaseURL(server.URL),
+	)
+}
+
+func TestGetCharacterGuildUsesStandInServer(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("Expected bearer token, got '%s'", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/profile/wow/character/area-52/testchar" {
+			t.Errorf("Unexpected path '%s'", r.URL.Path)
+		}
+		if ns := r.URL.Query().Get("namespace"); ns != "profile-eu" {
+			t.Errorf("Expected namespace 'profile-eu', got '%s'", ns)
+		}
+		if locale := r.URL.Query().Get("locale"); locale != "en_GB" {
+			t.Errorf("Expected locale 'en_GB', got '%s'", locale)
+		}
+		w.Write([]byte(`{"name":"Testchar","guild":{"name":"Stand and Deliver","id":70395110,"realm":{"name":"Area 52","slug":"area-52"}}}`))
+	})
+
+	client := newTestClient(server, RegionEU)
+	guild, err := client.GetCharacterGuild(context.Background(), "TestChar", "Area 52")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if guild == nil || guild.ID != 70395110 {
+		t.Errorf("Expected guild 70395110, got %+v", guild)
+	}
+}
+
+func TestWithLocale(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if locale := r.URL.Query().Get("locale"); locale != "de_DE" {
+			t.Errorf("Expected locale 'de_DE', got '%s'", locale)
+		}
+		w.Write([]byte(`{"name":"Testchar"}`))
+	})
+
+	client := NewBlizzardClient("test-id", "test-secret", RegionEU,
+		WithHTTPClient(server.Client()),
+		WithOAuthURL(server.URL+"/oauth/token"),
+		WithAPIBaseURL(server.URL),
+		WithLocale("de_DE"),
+	)
+	if _, err := client.GetCharacterGuild(context.Background(), "TestChar", "Area 52"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCharacterExistsNotFound(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	client := newTestClient(server, RegionUS)
+	exists, err := client.CharacterExists(context.Background(), "nobody", "cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("Expected character to not exist")
+	}
+}
+
+func TestConcurrentRequestsShareOneTokenFetch(t *testing.T) {
+	var tokenRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Testchar"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CharacterExists(context.Background(), "testchar", "cenarius"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("Expected 1 token request, got %d", n)
+	}
+}
+
+// Test that tokens living shorter than the refresh window are not refreshed on every call
+func TestShortLivedTokenRefresh(t *testing.T) {
+	var tokenRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", ExpiresIn: 120})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider := newTokenProvider("test-id", "test-secret", server.URL+"/oauth/token", server.Client())
+	for i := 0; i < 5; i++ {
+		if _, err := provider.Token(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("Expected 1 token request for a fresh two minute token, got %d", n)
+	}
+}
+
+func TestTokenErrorResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_client"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+	_, err := client.CharacterExists(context.Background(), "testchar", "cenarius")
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("Expected token request error, got %v", err)
+	}
+}
+
+func TestUnauthorizedResponseRefreshesToken(t *testing.T) {
+	var tokenRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name":"Testchar"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+	exists, err := client.CharacterExists(context.Background(), "testchar", "cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("Expected character to exist after token refresh")
+	}
+	if n := atomic.LoadInt32(&tokenRequests); n != 2 {
+		t.Errorf("Expected 2 token requests, got %d", n)
+	}
+}
+
+func TestTransientErrorsAreRetried(t *testing.T) {
+	var apiRequests int32
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&apiRequests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"name":"Testchar"}`))
+		}
+	})
+
+	client := NewBlizzardClient("test-id", "test-secret", RegionUS,
+		WithHTTPClient(server.Client()),
+		WithOAuthURL(server.URL+"/oauth/token"),
+		WithAPIBaseURL(server.URL),
+		WithRetryPolicy(3, time.Millisecond, 5*time.Millisecond),
+	)
+
+	exists, err := client.CharacterExists(context.Background(), "testchar", "cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("Expected character to exist after retries")
+	}
+
+	// The realm index accounts for one more request
+	usage := client.QuotaUsage()
+	if usage.TotalRequests != 4 || usage.Retries != 2 || usage.RateLimited != 1 {
+		t.Errorf("Unexpected quota usage: %+v", usage)
+	}
+	if usage.HourlyUsed() < 3 {
+		t.Errorf("Expected at least 3 requests counted against the hourly quota, got %d", usage.HourlyUsed())
+	}
+}
+
+func TestRetriesGiveUpAfterMaxAttempts(t *testing.T) {
+	var apiRequests int32
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&apiRequests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	client := NewBlizzardClient("test-id", "test-secret", RegionUS,
+		WithHTTPClient(server.Client()),
+		WithOAuthURL(server.URL+"/oauth/token"),
+		WithAPIBaseURL(server.URL),
+		WithRetryPolicy(2, time.Millisecond, 5*time.Millisecond),
+	)
+
+	if _, err := client.CharacterExists(context.Background(), "testchar", "cenarius"); err == nil {
+		t.Error("Expected an error after exhausting retries")
+	}
+	if n := atomic.LoadInt32(&apiRequests); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("Expected 3s, got %v (ok=%v)", d, ok)
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(future); !ok || d <= 0 || d > time.Minute {
+		t.Errorf("Expected a delay of up to 1m, got %v (ok=%v)", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("Expected invalid Retry-After to be rejected")
+	}
+}
+
+func TestRequestHonorsContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer close(release)
+
+	client := newTestClient(server, RegionUS)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.CharacterExists(ctx, "testchar", "cenarius")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected request to be cancelled promptly, took %v", elapsed)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/profile/wow/character/cenarius/missing"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasPrefix(r.URL.Path, "/data/wow/guild/"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+
+	client := NewBlizzardClient("test-id", "test-secret", RegionUS,
+		WithHTTPClient(server.Client()),
+		WithOAuthURL(server.URL+"/oauth/token"),
+		WithAPIBaseURL(server.URL),
+		WithRetryPolicy(0, time.Millisecond, time.Millisecond),
+	)
+	ctx := context.Background()
+
+	_, err := client.GetCharacterGuild(ctx, "missing", "cenarius")
+	if !errors.Is(err, ErrCharacterNotFound) {
+		t.Errorf("Expected ErrCharacterNotFound, got %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Endpoint != "/profile/wow/character/cenarius/missing" {
+		t.Errorf("Expected APIError with status 404 and endpoint, got %+v", apiErr)
+	}
+
+	_, err = client.GetGuildMemberInfo(ctx, "testchar", "cenarius", "No Such Guild")
+	if !errors.Is(err, ErrGuildNotFound) {
+		t.Errorf("Expected ErrGuildNotFound, got %v", err)
+	}
+
+	_, err = client.CharacterExists(ctx, "testchar", "cenarius")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestGetGuildRoster(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/wow/guild/cenarius/stand-and-deliver/roster" {
+			t.Errorf("Unexpected path '%s'", r.URL.Path)
+		}
+		w.Write([]byte(`{
+			"guild": {"name": "Stand and Deliver", "id": 70395110},
+			"members": [
+				{"character": {"id": 1, "name": "Tanky", "level": 80, "realm": {"slug": "cenarius"}, "playable_class": {"id": 1}, "playable_race": {"id": 3}}, "rank": 0},
+				{"character": {"id": 2, "name": "Healy", "level": 75, "realm": {"slug": "cenarius"}, "playable_class": {"id": 5}, "playable_race": {"id": 10}}, "rank": 4}
+			]
+		}`))
+	})
+
+	client := newTestClient(server, RegionUS)
+	roster, err := client.GetGuildRoster(context.Background(), "cenarius", "stand-and-deliver")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(roster.Members) != 2 {
+		t.Fatalf("Expected 2 members, got %d", len(roster.Members))
+	}
+
+	healy := roster.FindMember("healy", "cenarius")
+	if healy == nil {
+		t.Fatal("Expected to find Healy on the roster")
+	}
+	if healy.Character.ID != 2 || healy.Character.Level != 75 || healy.Rank != 4 {
+		t.Errorf("Unexpected member data: %+v", healy)
+	}
+	if healy.Character.PlayableClass.Name != "Priest" || healy.Character.PlayableRace.Name != "Blood Elf" {
+		t.Errorf("Expected Blood Elf Priest, got %s %s", healy.Character.PlayableRace.Name, healy.Character.PlayableClass.Name)
+	}
+
+	member, err := client.GetGuildMemberInfo(context.Background(), "Nobody", "cenarius", "Stand and Deliver")
+	if !errors.Is(err, ErrNotGuildMember) || member != nil {
+		t.Errorf("Expected ErrNotGuildMember, got %v", err)
+	}
+}
+
+// memoryCacheStore is an in-memory CacheStore for tests
+type memoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+func (s *memoryCacheStore) LoadCacheEntry(key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (s *memoryCacheStore) SaveCacheEntry(entry CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.Key] = entry
+	return nil
+}
+
+func TestResponsesAreCachedAndRevalidated(t *testing.T) {
+	const lastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+	var apiRequests, notModified int32
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&apiRequests, 1)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`{"name":"Testchar","guild":{"name":"Stand and Deliver","id":70395110}}`))
+	})
+
+	store := &memoryCacheStore{entries: make(map[string]CacheEntry)}
+	newClient := func(ttl time.Duration) *BlizzardClient {
+		return NewBlizzardClient("test-id", "test-secret", RegionUS,
+			WithHTTPClient(server.Client()),
+			WithOAuthURL(server.URL+"/oauth/token"),
+			WithAPIBaseURL(server.URL),
+			WithCacheTTL(EndpointCharacterProfile, ttl),
+			WithCacheStore(store),
+		)
+	}
+	ctx := context.Background()
+
+	// CharacterExists and GetCharacterGuild share the profile response
+	client := newClient(time.Minute)
+	if _, err := client.CharacterExists(ctx, "testchar", "cenarius"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.GetCharacterGuild(ctx, "testchar", "cenarius"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&apiRequests); n != 1 {
+		t.Errorf("Expected 1 API request, got %d", n)
+	}
+	// The profile and the realm index are persisted
+	if len(store.entries) != 2 {
+		t.Errorf("Expected 2 persisted entries, got %d", len(store.entries))
+	}
+
+	// A restarted client revalidates the persisted entry once it has expired
+	for key, entry := range store.entries {
+		entry.ExpiresAt = time.Now().Add(-time.Second)
+		store.entries[key] = entry
+	}
+	restarted := newClient(time.Minute)
+	guild, err := restarted.GetCharacterGuild(ctx, "testchar", "cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if guild == nil || guild.ID != 70395110 {
+		t.Errorf("Expected cached guild 70395110, got %+v", guild)
+	}
+	if n := atomic.LoadInt32(&notModified); n != 1 {
+		t.Errorf("Expected 1 conditional request answered with 304, got %d", n)
+	}
+}
+
+func TestGetMythicKeystoneProfile(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/profile/wow/character/cenarius/keyer/mythic-keystone-profile":
+			w.Write([]byte(`{"character": {"name": "Keyer", "realm": {"name": "Cenarius"}}, "current_mythic_rating": {"rating": 2450.5}, "seasons": [{"id": 12}, {"id": 13}]}`))
+		case "/profile/wow/character/cenarius/veteran/mythic-keystone-profile":
+			w.Write([]byte(`{"character": {"name": "Veteran", "realm": {"name": "Cenarius"}}, "current_mythic_rating": {"rating": 2600}, "seasons": [{"id": 11}, {"id": 12}]}`))
+		case "/profile/wow/character/cenarius/veteran/mythic-keystone-profile/season/12":
+			w.Write([]byte(`{"mythic_rating": {"rating": 2600}, "best_runs": [{"dungeon": {"name": "The Stonevault", "id": 1}, "keystone_level": 14}]}`))
+		case "/profile/wow/character/cenarius/keyer/mythic-keystone-profile/season/13":
+			w.Write([]byte(`{"best_runs": [
+				{"dungeon": {"name": "The Stonevault", "id": 1}, "keystone_level": 10, "duration": 1800000, "is_completed_within_time": true, "mythic_rating": {"rating": 250}},
+				{"dungeon": {"name": "The Stonevault", "id": 1}, "keystone_level": 11, "duration": 2400000, "is_completed_within_time": false, "mythic_rating": {"rating": 240}},
+				{"dungeon": {"name": "Ara-Kara", "id": 2}, "keystone_level": 12, "duration": 1700000, "is_completed_within_time": true, "mythic_rating": {"rating": 280}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	client := newTestClient(server, RegionUS)
+	profile, err := client.GetMythicKeystoneProfile(context.Background(), "Keyer", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if profile.CurrentRating != 2450.5 || profile.SeasonID != 13 {
+		t.Errorf("Unexpected profile: %+v", profile)
+	}
+	if len(profile.BestRuns) != 2 {
+		t.Fatalf("Expected 2 best runs, got %d", len(profile.BestRuns))
+	}
+	if profile.BestRuns[0].Dungeon.Name != "Ara-Kara" || profile.BestRuns[1].KeystoneLevel != 10 {
+		t.Errorf("Unexpected best runs: %+v", profile.BestRuns)
+	}
+
+	// Last season's rating and runs are not reported as current, even when the profile
+	// still carries the rating
+	profile, err = client.GetMythicKeystoneProfile(context.Background(), "Veteran", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if profile.CurrentRating != 0 || profile.SeasonID != 13 || len(profile.BestRuns) != 0 {
+		t.Errorf("Expected no current season data, got %+v", profile)
+	}
+
+	_, err = client.GetMythicKeystoneProfile(context.Background(), "Nobody", "Cenarius")
+	if !errors.Is(err, ErrCharacterNotFound) {
+		t.Errorf("Expected ErrCharacterNotFound, got %v", err)
+	}
+}
+
+func TestGetRaidEncountersCurrentTier(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/profile/wow/character/cenarius/raider/encounters/raids":
+			w.Write([]byte(`{"character": {"name": "Raider", "realm": {"name": "Cenarius"}}, "expansions": [
+				{"expansion": {"name": "Dragonflight", "id": 503}, "instances": [{"instance": {"name": "Amirdrassil", "id": 1207}, "modes": []}]},
+				{"expansion": {"name": "The War Within", "id": 514}, "instances": [
+					{"instance": {"name": "Nerub-ar Palace", "id": 1273}, "modes": []},
+					{"instance": {"name": "Liberation of Undermine", "id": 1296}, "modes": [
+						{"difficulty": {"type": "HEROIC", "name": "Heroic"}, "progress": {"completed_count": 5, "total_count": 8}},
+						{"difficulty": {"type": "NORMAL", "name": "Normal"}, "progress": {"completed_count": 8, "total_count": 8}}
+					]}
+				]}
+			]}`))
+		case "/data/wow/journal-expansion/index":
+			w.Write([]byte(`{"tiers": [{"name": "Dragonflight", "id": 503}, {"name": "Midnight", "id": 516}, {"name": "The War Within", "id": 514}]}`))
+		case "/data/wow/journal-expansion/516":
+			w.Write([]byte(`{"id": 516, "raids": []}`))
+		case "/data/wow/journal-expansion/514":
+			w.Write([]byte(`{"id": 514, "raids": [{"name": "Nerub-ar Palace", "id": 1273}, {"name": "Manaforge Omega", "id": 1302}, {"name": "Liberation of Undermine", "id": 1296}]}`))
+		case "/data/wow/journal-instance/1302":
+			w.Write([]byte(`{"id": 1302, "encounters": [{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}, {"id": 6}, {"id": 7}, {"id": 8}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	client := newTestClient(server, RegionUS)
+	ctx := context.Background()
+	tier, err := client.GetCurrentRaidTier(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tier.ExpansionName != "The War Within" || tier.InstanceName != "Manaforge Omega" || tier.EncounterCount != 8 {
+		t.Errorf("Unexpected current tier: %+v", tier)
+	}
+
+	encounters, err := client.GetRaidEncounters(ctx, "Raider", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The character has no kills in the current raid
+	if instance := encounters.InstanceProgress(tier.InstanceID); instance != nil {
+		t.Errorf("Expected no progress in the current raid, got %+v", instance)
+	}
+
+	instance := encounters.InstanceProgress(1296)
+	if instance == nil {
+		t.Fatal("Expected progress in Liberation of Undermine")
+	}
+	modes := instance.ModesByDifficulty()
+	if len(modes) != 2 || modes[0].Difficulty.Type != "NORMAL" || modes[1].Progress.CompletedCount != 5 {
+		t.Errorf("Unexpected modes order: %+v", modes)
+	}
+}
+
+func TestGetCharacterEquipment(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/profile/wow/character/cenarius/geared":
+			w.Write([]byte(`{"name": "Geared", "level": 80, "average_item_level": 624, "equipped_item_level": 621}`))
+		case "/profile/wow/character/cenarius/geared/equipment":
+			w.Write([]byte(`{"equipped_items": [
+				{"slot": {"type": "NECK", "name": "Neck"}, "name": "Chain", "level": {"value": 626}, "sockets": [{"socket_type": {"type": "PRISMATIC"}}, {"socket_type": {"type": "PRISMATIC"}, "item": {"name": "Gem", "id": 1}}]},
+				{"slot": {"type": "BACK", "name": "Back"}, "name": "Cloak", "level": {"value": 619}},
+				{"slot": {"type": "WRIST", "name": "Wrist"}, "name": "Bracers", "level": {"value": 619}, "enchantments": [{"display_string": "Enchanted: Avoidance", "enchantment_slot": {"id": 0, "type": "PERMANENT"}}]},
+				{"slot": {"type": "OFF_HAND", "name": "Off Hand"}, "name": "Dagger", "inventory_type": {"type": "WEAPON"}, "level": {"value": 619}}
+			]}`))
+		case "/profile/wow/character/cenarius/tank/equipment":
+			w.Write([]byte(`{"equipped_items": [
+				{"slot": {"type": "OFF_HAND", "name": "Off Hand"}, "name": "Bulwark", "inventory_type": {"type": "SHIELD"}, "level": {"value": 619}},
+				{"slot": {"type": "OFF_HAND", "name": "Off Hand"}, "name": "Tome", "inventory_type": {"type": "HOLDABLE"}, "level": {"value": 619}}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	client := newTestClient(server, RegionUS)
+	ctx := context.Background()
+
+	summary, err := client.GetCharacterSummary(ctx, "Geared", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.AverageItemLevel != 624 || summary.EquippedItemLevel != 621 {
+		t.Errorf("Unexpected item levels: %+v", summary)
+	}
+
+	equipment, err := client.GetCharacterEquipment(ctx, "Geared", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	missing := equipment.MissingEnchants()
+	if len(missing) != 2 || missing[0].Slot.Type != "BACK" || missing[1].Slot.Type != "OFF_HAND" {
+		t.Errorf("Expected the back and off-hand weapon slots to be missing an enchant, got %+v", missing)
+	}
+	if empty := equipment.EquippedItems[0].EmptySockets(); empty != 1 {
+		t.Errorf("Expected 1 empty socket, got %d", empty)
+	}
+
+	// Shields and held items in the off hand cannot be enchanted
+	equipment, err = client.GetCharacterEquipment(ctx, "Tank", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if missing := equipment.MissingEnchants(); len(missing) != 0 {
+		t.Errorf("Expected no missing enchants for off-hand shields and held items, got %+v", missing)
+	}
+}
+
+func TestRealmResolution(t *testing.T) {
+	var indexRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/data/wow/realm/index", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&indexRequests, 1)
+		if ns := r.URL.Query().Get("namespace"); ns != "dynamic-us" {
+			t.Errorf("Expected namespace 'dynamic-us', got '%s'", ns)
+		}
+		w.Write([]byte(testRealmIndex))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/profile/wow/character/malganis/testchar" {
+			t.Errorf("Unexpected path '%s'", r.URL.Path)
+		}
+		w.Write([]byte(`{"name":"Testchar"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+	ctx := context.Background()
+
+	for _, input := range []string{"Mal'Ganis", "malganis", "MAL GANIS", "mal-ganis"} {
+		if _, err := client.CharacterExists(ctx, "testchar", input); err != nil {
+			t.Errorf("Unexpected error for realm '%s': %v", input, err)
+		}
+	}
+	if n := atomic.LoadInt32(&indexRequests); n != 1 {
+		t.Errorf("Expected 1 realm index request, got %d", n)
+	}
+
+	cases := map[string]string{
+		"aerie peak":        "aerie-peak",
+		"AeriePeak":         "aerie-peak",
+		"kel'thuzad":        "kelthuzad",
+		"Aggra (Portugues)": "aggra-portugues",
+		"area52":            "area-52",
+	}
+	for input, want := range cases {
+		realm, err := client.ResolveRealm(ctx, input)
+		if err != nil || realm.Slug != want {
+			t.Errorf("Expected '%s' to resolve to '%s', got %+v (%v)", input, want, realm, err)
+		}
+	}
+
+	_, err := client.CharacterExists(ctx, "testchar", "Mal Gannis")
+	var notFound *RealmNotFoundError
+	if !errors.Is(err, ErrRealmNotFound) || !errors.As(err, &notFound) {
+		t.Fatalf("Expected RealmNotFoundError, got %v", err)
+	}
+	if len(notFound.Suggestions) == 0 || notFound.Suggestions[0] != "Mal'Ganis" {
+		t.Errorf("Expected Mal'Ganis to be suggested, got %v", notFound.Suggestions)
+	}
+}
+
+func TestRealmIndexUnavailableFallsBackToSlug(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/data/wow/realm/index", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/profile/wow/character/area-52/testchar" {
+			t.Errorf("Unexpected path '%s'", r.URL.Path)
+		}
+		w.Write([]byte(`{"name":"Testchar"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+	if _, err := client.CharacterExists(context.Background(), "testchar", "Area 52"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Test that a caller giving up on a slow realm index load does not make the next
+// lookups fall back to derived slugs
+func TestRealmIndexLoadOutlivesCaller(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "test-token", ExpiresIn: 86399})
+	})
+	mux.HandleFunc("/data/wow/realm/index", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(testRealmIndex))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newTestClient(server, RegionUS)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetRealmIndex(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller's deadline to be exceeded, got %v", err)
+	}
+
+	realm, err := client.ResolveRealm(context.Background(), "Mal'Ganis")
+	if err != nil || realm.Slug != "malganis" {
+		t.Errorf("Expected the realm index to load for the next caller, got %+v (%v)", realm, err)
+	}
+}
+
+func TestGetCharacterMedia(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/profile/wow/character/cenarius/testchar":
+			w.Write([]byte(`{"name": "Testchar", "level": 80, "character_class": {"id": 8, "name": "Mage"}, "race": {"id": 10, "name": "Blood Elf"}, "faction": {"type": "HORDE", "name": "Horde"}, "active_spec": {"id": 63, "name": "Fire"}}`))
+		case "/profile/wow/character/cenarius/testchar/character-media":
+			w.Write([]byte(`{"assets": [{"key": "avatar", "value": "https://render.worldofwarcraft.com/avatar.jpg"}, {"key": "inset", "value": "https://render.worldofwarcraft.com/inset.jpg"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	client := newTestClient(server, RegionUS)
+	ctx := context.Background()
+
+	summary, err := client.GetCharacterSummary(ctx, "Testchar", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.CharacterClass.ID != 8 || summary.Race.Name != "Blood Elf" || summary.Faction.Type != "HORDE" || summary.ActiveSpec.Name != "Fire" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	media, err := client.GetCharacterMedia(ctx, "Testchar", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if avatar := media.Asset(MediaAvatar); avatar != "https://render.worldofwarcraft.com/avatar.jpg" {
+		t.Errorf("Unexpected avatar '%s'", avatar)
+	}
+	if raw := media.Asset(MediaMainRaw); raw != "" {
+		t.Errorf("Expected no main-raw asset, got '%s'", raw)
+	}
+
+	if _, err := client.GetCharacterMedia(ctx, "Nobody", "Cenarius"); !errors.Is(err, ErrCharacterNotFound) {
+		t.Errorf("Expected ErrCharacterNotFound, got %v", err)
+	}
+}
+
+func TestGetCharacterAchievements(t *testing.T) {
+	server := newStandInServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/profile/wow/character/cenarius/testchar/achievements" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"total_quantity": 2, "total_points": 20, "achievements": [
+			{"id": 40253, "achievement": {"id": 40253, "name": "Cutting Edge: Queen Ansurek"}, "completed_timestamp": 1727740800000},
+			{"id": 20525, "achievement": {"id": 20525, "name": "Keystone Master: Season Four"}}
+		]}`))
+	})
+
+	client := newTestClient(server, RegionUS)
+	ctx := context.Background()
+
+	achievements, err := client.GetCharacterAchievements(ctx, "Testchar", "Cenarius")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !achievements.Completed(40253) {
+		t.Error("Expected Cutting Edge to be completed")
+	}
+	if achievements.Completed(20525) || achievements.Completed(1) {
+		t.Error("Expected achievements in progress or missing to be incomplete")
+	}
+
+	if _, err := client.GetCharacterAchievements(ctx, "Nobody", "Cenarius"); !errors.Is(err, ErrCharacterNotFound) {
+		t.Errorf("Expected ErrCharacterNotFound, got %v", err)
+	}
+}
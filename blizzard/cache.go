@@ -0,0 +1,202 @@
+package blizzard
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+// Endpoint names a group of API endpoints that share a cache TTL
+type Endpoint string
+
+const (
+	EndpointCharacterProfile Endpoint = "character-profile"
+	EndpointGuildRoster      Endpoint = "guild-roster"
+	EndpointMythicKeystone   Endpoint = "mythic-keystone"
+	EndpointRaidEncounters   Endpoint = "raid-encounters"
+	EndpointEquipment        Endpoint = "equipment"
+	EndpointRealmIndex       Endpoint = "realm-index"
+	EndpointCharacterMedia   Endpoint = "character-media"
+	EndpointAchievements     Endpoint = "achievements"
+	EndpointSeasonIndex      Endpoint = "season-index"
+	EndpointJournal          Endpoint = "journal"
+)
+
+// defaultCacheTTLs is how long responses of each endpoint are served without revalidation
+var defaultCacheTTLs = map[Endpoint]time.Duration{
+	EndpointCharacterProfile: 10 * time.Minute,
+	EndpointGuildRoster:      15 * time.Minute,
+	EndpointMythicKeystone:   10 * time.Minute,
+	EndpointRaidEncounters:   30 * time.Minute,
+	EndpointEquipment:        10 * time.Minute,
+	EndpointRealmIndex:       24 * time.Hour,
+	EndpointCharacterMedia:   time.Hour,
+	EndpointAchievements:     time.Hour,
+	EndpointSeasonIndex:      6 * time.Hour,
+	EndpointJournal:          24 * time.Hour,
+}
+
+// maxCacheEntries bounds the number of responses kept in memory
+const maxCacheEntries = 5000
+
+// CacheEntry is a cached API response
+type CacheEntry struct {
+	Key          string
+	Body         []byte
+	LastModified string
+	ExpiresAt    time.Time
+}
+
+// CacheStore persists cached responses so they survive restarts
+type CacheStore interface {
+	// LoadCacheEntry returns the stored entry for the key, or nil if there is none
+	LoadCacheEntry(key string) (*CacheEntry, error)
+	SaveCacheEntry(entry CacheEntry) error
+}
+
+// responseCache keeps API responses in memory, optionally backed by a CacheStore
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+	ttls    map[Endpoint]time.Duration
+	store   CacheStore
+}
+
+func newResponseCache(ttls map[Endpoint]time.Duration, store CacheStore) *responseCache {
+	merged := make(map[Endpoint]time.Duration, len(defaultCacheTTLs))
+	for endpoint, ttl := range defaultCacheTTLs {
+		merged[endpoint] = ttl
+	}
+	for endpoint, ttl := range ttls {
+		merged[endpoint] = ttl
+	}
+	return &responseCache{
+		entries: make(map[string]*CacheEntry),
+		ttls:    merged,
+		store:   store,
+	}
+}
+
+func (rc *responseCache) ttl(endpoint Endpoint) time.Duration {
+	return rc.ttls[endpoint]
+}
+
+// lookup returns a copy of the entry for the key from memory or the store
+func (rc *responseCache) lookup(key string) *CacheEntry {
+	rc.mu.Lock()
+	entry, ok := rc.entries[key]
+	rc.mu.Unlock()
+	if ok {
+		copied := *entry
+		return &copied
+	}
+
+	if rc.store == nil {
+		return nil
+	}
+	stored, err := rc.store.LoadCacheEntry(key)
+	if err != nil {
+		util.Logger.Printf("Error loading cached response for %s: %v", key, err)
+		return nil
+	}
+	if stored == nil {
+		return nil
+	}
+
+	rc.mu.Lock()
+	rc.entries[key] = stored
+	rc.mu.Unlock()
+	copied := *stored
+	return &copied
+}
+
+// put stores the entry in memory and, if configured, in the store
+func (rc *responseCache) put(entry CacheEntry) {
+	rc.mu.Lock()
+	rc.entries[entry.Key] = &entry
+	if len(rc.entries) > maxCacheEntries {
+		rc.evictLocked()
+	}
+	rc.mu.Unlock()
+
+	if rc.store != nil {
+		if err := rc.store.SaveCacheEntry(entry); err != nil {
+			util.Logger.Printf("Error saving cached response for %s: %v", entry.Key, err)
+		}
+	}
+}
+
+// evictLocked drops expired entries, then the entries closest to expiry, until the
+// cache is back under its size limit; the caller must hold rc.mu
+func (rc *responseCache) evictLocked() {
+	now := time.Now()
+	for key, entry := range rc.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(rc.entries, key)
+		}
+	}
+	for len(rc.entries) > maxCacheEntries {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range rc.entries {
+			if oldestKey == "" || entry.ExpiresAt.Before(oldest) {
+				oldestKey, oldest = key, entry.ExpiresAt
+			}
+		}
+		delete(rc.entries, oldestKey)
+	}
+}
+
+// getCached performs a GET request through the response cache. Fresh entries are served
+// without contacting the API; stale entries are revalidated with If-Modified-Since and
+// served if the API answers 304, is unavailable or cannot be reached. Only 200
+// responses are cached.
+func (c *BlizzardClient) getCached(ctx context.Context, endpoint Endpoint, fullURL string) (int, []byte, error) {
+	entry := c.cache.lookup(fullURL)
+	if entry != nil && time.Now().Before(entry.ExpiresAt) {
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Serving %s from cache", fullURL)
+		}
+		return http.StatusOK, entry.Body, nil
+	}
+
+	var header http.Header
+	if entry != nil && entry.LastModified != "" {
+		header = http.Header{}
+		header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	resp, err := c.send(ctx, fullURL, header)
+	if err != nil {
+		if entry != nil && ctx.Err() == nil {
+			util.Logger.Printf("Serving stale cached response for %s after error: %v", fullURL, err)
+			return http.StatusOK, entry.Body, nil
+		}
+		return 0, nil, err
+	}
+
+	ttl := c.cache.ttl(endpoint)
+	switch {
+	case entry != nil && (resp.status == http.StatusTooManyRequests || resp.status >= 500):
+		util.Logger.Printf("Serving stale cached response for %s after status %d", fullURL, resp.status)
+		return http.StatusOK, entry.Body, nil
+	case resp.status == http.StatusNotModified && entry != nil:
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Cached response for %s is still current", fullURL)
+		}
+		entry.ExpiresAt = time.Now().Add(ttl)
+		c.cache.put(*entry)
+		return http.StatusOK, entry.Body, nil
+	case resp.status == http.StatusOK && ttl > 0:
+		c.cache.put(CacheEntry{
+			Key:          fullURL,
+			Body:         resp.body,
+			LastModified: resp.header.Get("Last-Modified"),
+			ExpiresAt:    time.Now().Add(ttl),
+		})
+	}
+	return resp.status, resp.body, nil
+}
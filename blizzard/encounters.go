@@ -0,0 +1,176 @@
+package blizzard
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// raidDifficultyOrder lists raid difficulties from easiest to hardest
+var raidDifficultyOrder = []string{"LFR", "NORMAL", "HEROIC", "MYTHIC"}
+
+// RaidEncounterProgress is a character's kill count for a single boss
+type RaidEncounterProgress struct {
+	Encounter struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"encounter"`
+	CompletedCount    int   `json:"completed_count"`
+	LastKillTimestamp int64 `json:"last_kill_timestamp"`
+}
+
+// RaidModeProgress is a character's progress in a raid on one difficulty
+type RaidModeProgress struct {
+	Difficulty struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"difficulty"`
+	Status struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"status"`
+	Progress struct {
+		CompletedCount int                     `json:"completed_count"`
+		TotalCount     int                     `json:"total_count"`
+		Encounters     []RaidEncounterProgress `json:"encounters"`
+	} `json:"progress"`
+}
+
+// RaidInstanceProgress is a character's progress in a single raid
+type RaidInstanceProgress struct {
+	Instance struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"instance"`
+	Modes []RaidModeProgress `json:"modes"`
+}
+
+// ModesByDifficulty returns the raid's modes ordered from Raid Finder to Mythic
+func (i *RaidInstanceProgress) ModesByDifficulty() []RaidModeProgress {
+	var ordered []RaidModeProgress
+	for _, difficulty := range raidDifficultyOrder {
+		for _, mode := range i.Modes {
+			if mode.Difficulty.Type == difficulty {
+				ordered = append(ordered, mode)
+			}
+		}
+	}
+	return ordered
+}
+
+// RaidExpansionProgress groups raid progress by expansion
+type RaidExpansionProgress struct {
+	Expansion struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"expansion"`
+	Instances []RaidInstanceProgress `json:"instances"`
+}
+
+// RaidEncounters is a character's raid progression across all expansions
+type RaidEncounters struct {
+	Character struct {
+		Name  string `json:"name"`
+		Realm Realm  `json:"realm"`
+	} `json:"character"`
+	Expansions []RaidExpansionProgress `json:"expansions"`
+}
+
+// InstanceProgress returns the character's progress in a raid, or nil if the character
+// has never killed one of its bosses
+func (r *RaidEncounters) InstanceProgress(instanceID int) *RaidInstanceProgress {
+	for i := range r.Expansions {
+		for j := range r.Expansions[i].Instances {
+			if r.Expansions[i].Instances[j].Instance.ID == instanceID {
+				return &r.Expansions[i].Instances[j]
+			}
+		}
+	}
+	return nil
+}
+
+// RaidTier is the current raid according to the adventure journal
+type RaidTier struct {
+	ExpansionName  string
+	ExpansionID    int
+	InstanceName   string
+	InstanceID     int
+	EncounterCount int
+}
+
+// journalRef is a named reference to a journal resource
+type journalRef struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// GetCurrentRaidTier returns the newest raid of the newest expansion in the adventure
+// journal, taken as the highest IDs, with its number of bosses
+func (c *BlizzardClient) GetCurrentRaidTier(ctx context.Context) (*RaidTier, error) {
+	var index struct {
+		Tiers []journalRef `json:"tiers"`
+	}
+	err := c.getNamespacedJSON(ctx, EndpointJournal, "static", "/data/wow/journal-expansion/index", nil, &index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal expansion index: %w", err)
+	}
+	sort.Slice(index.Tiers, func(i, j int) bool { return index.Tiers[i].ID > index.Tiers[j].ID })
+
+	// An expansion is only listed with raids once its first raid is announced
+	for _, tier := range index.Tiers {
+		var expansion struct {
+			Raids []journalRef `json:"raids"`
+		}
+		path := fmt.Sprintf("/data/wow/journal-expansion/%d", tier.ID)
+		if err := c.getNamespacedJSON(ctx, EndpointJournal, "static", path, nil, &expansion); err != nil {
+			return nil, fmt.Errorf("failed to get journal expansion: %w", err)
+		}
+		if len(expansion.Raids) == 0 {
+			continue
+		}
+
+		raid := expansion.Raids[0]
+		for _, r := range expansion.Raids {
+			if r.ID > raid.ID {
+				raid = r
+			}
+		}
+		var instance struct {
+			Encounters []journalRef `json:"encounters"`
+		}
+		path = fmt.Sprintf("/data/wow/journal-instance/%d", raid.ID)
+		if err := c.getNamespacedJSON(ctx, EndpointJournal, "static", path, nil, &instance); err != nil {
+			return nil, fmt.Errorf("failed to get journal instance: %w", err)
+		}
+		return &RaidTier{
+			ExpansionName:  tier.Name,
+			ExpansionID:    tier.ID,
+			InstanceName:   raid.Name,
+			InstanceID:     raid.ID,
+			EncounterCount: len(instance.Encounters),
+		}, nil
+	}
+	return nil, fmt.Errorf("journal has no raids")
+}
+
+// GetRaidEncounters returns a character's raid boss kills per raid and difficulty.
+// ErrCharacterNotFound is returned if the character does not exist.
+func (c *BlizzardClient) GetRaidEncounters(ctx context.Context, characterName, realm string) (*RaidEncounters, error) {
+	path, err := c.characterPath(ctx, characterName, realm, "/encounters/raids")
+	if err != nil {
+		return nil, err
+	}
+
+	var encounters RaidEncounters
+	if err := c.getJSON(ctx, EndpointRaidEncounters, path, ErrCharacterNotFound, &encounters); err != nil {
+		return nil, fmt.Errorf("failed to get raid encounters: %w", err)
+	}
+
+	if encounters.Character.Name == "" {
+		encounters.Character.Name = characterName
+	}
+	if encounters.Character.Realm.Name == "" {
+		encounters.Character.Realm.Name = realm
+	}
+	return &encounters, nil
+}
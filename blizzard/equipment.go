@@ -0,0 +1,133 @@
+package blizzard
+
+import (
+	"context"
+	"fmt"
+)
+
+// cosmeticSlots are ignored when reporting item levels
+var cosmeticSlots = map[string]bool{
+	"SHIRT":  true,
+	"TABARD": true,
+}
+
+// ItemEnchantment is an enchantment applied to an equipped item
+type ItemEnchantment struct {
+	DisplayString   string `json:"display_string"`
+	EnchantmentID   int    `json:"enchantment_id"`
+	EnchantmentSlot struct {
+		ID   int    `json:"id"`
+		Type string `json:"type"`
+	} `json:"enchantment_slot"`
+}
+
+// ItemSocket is a gem socket on an equipped item; Item is nil when the socket is empty
+type ItemSocket struct {
+	SocketType struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"socket_type"`
+	Item *struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"item"`
+}
+
+// EquippedItem is a single item in a character's equipment
+type EquippedItem struct {
+	Slot struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"slot"`
+	Item struct {
+		ID int `json:"id"`
+	} `json:"item"`
+	Name string `json:"name"`
+	// InventoryType tells off-hand weapons (WEAPON, WEAPONOFFHAND) from shields and
+	// held items (SHIELD, HOLDABLE)
+	InventoryType struct {
+		Type string `json:"type"`
+	} `json:"inventory_type"`
+	Quality struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"quality"`
+	Level struct {
+		Value int `json:"value"`
+	} `json:"level"`
+	Enchantments []ItemEnchantment `json:"enchantments"`
+	Sockets      []ItemSocket      `json:"sockets"`
+}
+
+// IsCosmetic reports whether the item sits in a slot that does not count towards item level
+func (i EquippedItem) IsCosmetic() bool {
+	return cosmeticSlots[i.Slot.Type]
+}
+
+// IsEnchantable reports whether the item is expected to carry a permanent enchant.
+// Off-hand weapons are, but shields and held items in the off hand cannot be enchanted.
+func (i EquippedItem) IsEnchantable() bool {
+	switch i.Slot.Type {
+	case "BACK", "CHEST", "WRIST", "LEGS", "FEET", "FINGER_1", "FINGER_2", "MAIN_HAND":
+		return true
+	case "OFF_HAND":
+		return i.InventoryType.Type != "SHIELD" && i.InventoryType.Type != "HOLDABLE"
+	}
+	return false
+}
+
+// HasPermanentEnchant reports whether the item carries a permanent enchant
+func (i EquippedItem) HasPermanentEnchant() bool {
+	for _, enchantment := range i.Enchantments {
+		if enchantment.EnchantmentSlot.Type == "PERMANENT" {
+			return true
+		}
+	}
+	return false
+}
+
+// EmptySockets returns the number of sockets on the item without a gem
+func (i EquippedItem) EmptySockets() int {
+	empty := 0
+	for _, socket := range i.Sockets {
+		if socket.Item == nil {
+			empty++
+		}
+	}
+	return empty
+}
+
+// CharacterEquipment is a character's equipped gear
+type CharacterEquipment struct {
+	Character struct {
+		Name  string `json:"name"`
+		Realm Realm  `json:"realm"`
+	} `json:"character"`
+	EquippedItems []EquippedItem `json:"equipped_items"`
+}
+
+// MissingEnchants returns the equipped items in enchantable slots without a permanent enchant
+func (e *CharacterEquipment) MissingEnchants() []EquippedItem {
+	var missing []EquippedItem
+	for _, item := range e.EquippedItems {
+		if item.IsEnchantable() && !item.HasPermanentEnchant() {
+			missing = append(missing, item)
+		}
+	}
+	return missing
+}
+
+// GetCharacterEquipment returns a character's equipped items. ErrCharacterNotFound is
+// returned if the character does not exist.
+func (c *BlizzardClient) GetCharacterEquipment(ctx context.Context, characterName, realm string) (*CharacterEquipment, error) {
+	path, err := c.characterPath(ctx, characterName, realm, "/equipment")
+	if err != nil {
+		return nil, err
+	}
+
+	var equipment CharacterEquipment
+	if err := c.getJSON(ctx, EndpointEquipment, path, ErrCharacterNotFound, &equipment); err != nil {
+		return nil, fmt.Errorf("failed to get character equipment: %w", err)
+	}
+	return &equipment, nil
+}
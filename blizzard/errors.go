@@ -0,0 +1,79 @@
+package blizzard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrCharacterNotFound is returned when a character does not exist on the given realm
+	ErrCharacterNotFound = errors.New("character not found")
+	// ErrGuildNotFound is returned when a guild does not exist on the given realm
+	ErrGuildNotFound = errors.New("guild not found")
+	// ErrRealmNotFound is returned when a realm name does not match any realm in the region
+	ErrRealmNotFound = errors.New("realm not found")
+	// ErrNotGuildMember is returned when a character is missing from a guild's roster
+	ErrNotGuildMember = errors.New("character is not a member of the guild")
+	// ErrRateLimited is returned when the Blizzard API keeps rejecting requests with 429
+	ErrRateLimited = errors.New("rate limited by the Blizzard API")
+	// ErrUnauthorized is returned when the Blizzard API rejects the client's credentials or token
+	ErrUnauthorized = errors.New("unauthorized by the Blizzard API")
+)
+
+// RealmNotFoundError is returned when user input does not match any realm. Suggestions
+// holds the names of similarly spelled realms, closest first.
+type RealmNotFoundError struct {
+	Input       string
+	Suggestions []string
+}
+
+func (e *RealmNotFoundError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return fmt.Sprintf("realm %q not found (did you mean %s?)", e.Input, strings.Join(e.Suggestions, ", "))
+	}
+	return fmt.Sprintf("realm %q not found", e.Input)
+}
+
+func (e *RealmNotFoundError) Is(target error) bool {
+	return target == ErrRealmNotFound
+}
+
+// APIError describes an unsuccessful response from the Blizzard API. It matches
+// ErrRateLimited and ErrUnauthorized by status code, and wraps a more specific
+// sentinel such as ErrCharacterNotFound when one applies.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Err        error
+}
+
+func newAPIError(statusCode int, endpoint string, err error) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Endpoint:   endpoint,
+		Err:        err,
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v (status %d from %s)", e.Err, e.StatusCode, e.Endpoint)
+	}
+	return fmt.Sprintf("API request to %s failed with status %d", e.Endpoint, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package blizzard
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+// Blizzard API quotas per client: 100 requests per second and 36,000 requests per hour
+const (
+	DefaultPerSecondLimit = 100
+	DefaultHourlyLimit    = 36000
+)
+
+// retryPolicy controls how failed idempotent requests are retried
+type retryPolicy struct {
+	maxRetries  int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxRetries:  3,
+	baseBackoff: 500 * time.Millisecond,
+	maxBackoff:  10 * time.Second,
+}
+
+// QuotaUsage reports how much of the Blizzard API quota the client has used
+type QuotaUsage struct {
+	PerSecondLimit  int
+	HourlyLimit     int
+	HourlyRemaining int
+	TotalRequests   int64
+	Retries         int64
+	RateLimited     int64
+	BlockedUntil    time.Time
+}
+
+// HourlyUsed returns the number of requests counted against the hourly quota
+func (q QuotaUsage) HourlyUsed() int {
+	return q.HourlyLimit - q.HourlyRemaining
+}
+
+// tokenBucket is a simple token bucket rate limiter
+type tokenBucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	refillRate float64 // tokens per second
+	last       time.Time
+}
+
+func newTokenBucket(capacity int, per time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity:   float64(capacity),
+		tokens:     float64(capacity),
+		refillRate: float64(capacity) / per.Seconds(),
+		last:       time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens += elapsed * b.refillRate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.refillRate * float64(time.Second))
+}
+
+func (b *tokenBucket) remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 0 {
+		return 0
+	}
+	return int(b.tokens)
+}
+
+// requestExecutor sends API requests while enforcing the per-second and hourly quotas,
+// honoring Retry-After and retrying idempotent requests with jittered exponential backoff
+type requestExecutor struct {
+	httpClient     *http.Client
+	retry          retryPolicy
+	perSecondLimit int
+	hourlyLimit    int
+	perSecond      *tokenBucket
+	hourly         *tokenBucket
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+	requests     int64
+	retries      int64
+	rateLimited  int64
+}
+
+func newRequestExecutor(httpClient *http.Client, retry retryPolicy, perSecondLimit, hourlyLimit int) *requestExecutor {
+	return &requestExecutor{
+		httpClient:     httpClient,
+		retry:          retry,
+		perSecondLimit: perSecondLimit,
+		hourlyLimit:    hourlyLimit,
+		perSecond:      newTokenBucket(perSecondLimit, time.Second),
+		hourly:         newTokenBucket(hourlyLimit, time.Hour),
+	}
+}
+
+// Do sends the request. GET requests that fail with a network error, 429 or a
+// transient 5xx status are retried; the last response or error is returned.
+// Waiting for quota or between retries stops as soon as the request's context is done.
+func (e *requestExecutor) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if err := e.waitForQuota(ctx); err != nil {
+			return nil, err
+		}
+
+		e.mu.Lock()
+		e.requests++
+		e.mu.Unlock()
+
+		resp, err := e.httpClient.Do(req)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || isTransientStatus(resp.StatusCode)
+		if !retryable || !idempotent || attempt >= e.retry.maxRetries {
+			return resp, err
+		}
+
+		delay := e.backoff(attempt)
+		if err != nil {
+			util.Logger.Printf("Request to %s failed (%v), retrying in %v", req.URL.Path, err, delay)
+		} else {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				e.mu.Lock()
+				e.rateLimited++
+				if until := time.Now().Add(delay); until.After(e.blockedUntil) {
+					e.blockedUntil = until
+				}
+				e.mu.Unlock()
+			}
+			util.Logger.Printf("Request to %s returned status %d, retrying in %v", req.URL.Path, resp.StatusCode, delay)
+			resp.Body.Close()
+		}
+
+		e.mu.Lock()
+		e.retries++
+		e.mu.Unlock()
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForQuota blocks until a request may be sent without exceeding the quotas
+func (e *requestExecutor) waitForQuota(ctx context.Context) error {
+	e.mu.Lock()
+	blocked := time.Until(e.blockedUntil)
+	e.mu.Unlock()
+
+	wait := e.perSecond.reserve()
+	if hourlyWait := e.hourly.reserve(); hourlyWait > wait {
+		wait = hourlyWait
+	}
+	if blocked > wait {
+		wait = blocked
+	}
+	if wait > 0 {
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Rate limit reached, waiting %v before next request", wait)
+		}
+		return sleepContext(ctx, wait)
+	}
+	return nil
+}
+
+// sleepContext waits for the given duration or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the jittered exponential delay before the given retry attempt
+func (e *requestExecutor) backoff(attempt int) time.Duration {
+	delay := e.retry.baseBackoff << attempt
+	if delay > e.retry.maxBackoff || delay <= 0 {
+		delay = e.retry.maxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Usage returns a snapshot of the executor's quota usage
+func (e *requestExecutor) Usage() QuotaUsage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return QuotaUsage{
+		PerSecondLimit:  e.perSecondLimit,
+		HourlyLimit:     e.hourlyLimit,
+		HourlyRemaining: e.hourly.remaining(),
+		TotalRequests:   e.requests,
+		Retries:         e.retries,
+		RateLimited:     e.rateLimited,
+		BlockedUntil:    e.blockedUntil,
+	}
+}
+
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
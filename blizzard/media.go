@@ -0,0 +1,49 @@
+package blizzard
+
+import (
+	"context"
+	"fmt"
+)
+
+// Media asset keys returned by the character media endpoint
+const (
+	MediaAvatar  = "avatar"
+	MediaInset   = "inset"
+	MediaMainRaw = "main-raw"
+)
+
+// MediaAsset is a single render of a character
+type MediaAsset struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// CharacterMedia holds the URLs of a character's renders
+type CharacterMedia struct {
+	Assets []MediaAsset `json:"assets"`
+}
+
+// Asset returns the URL of the asset with the given key, or "" if there is none
+func (m *CharacterMedia) Asset(key string) string {
+	for _, asset := range m.Assets {
+		if asset.Key == key {
+			return asset.Value
+		}
+	}
+	return ""
+}
+
+// GetCharacterMedia returns the avatar and other renders of a character.
+// ErrCharacterNotFound is returned if the character does not exist.
+func (c *BlizzardClient) GetCharacterMedia(ctx context.Context, characterName, realm string) (*CharacterMedia, error) {
+	path, err := c.characterPath(ctx, characterName, realm, "/character-media")
+	if err != nil {
+		return nil, err
+	}
+
+	var media CharacterMedia
+	if err := c.getJSON(ctx, EndpointCharacterMedia, path, ErrCharacterNotFound, &media); err != nil {
+		return nil, fmt.Errorf("failed to get character media: %w", err)
+	}
+	return &media, nil
+}
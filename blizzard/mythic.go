@@ -0,0 +1,170 @@
+package blizzard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+// MythicRating is a Mythic+ rating as reported by the API
+type MythicRating struct {
+	Rating float64 `json:"rating"`
+}
+
+// MythicKeystoneRun is a single best Mythic+ run
+type MythicKeystoneRun struct {
+	Dungeon struct {
+		Name string `json:"name"`
+		ID   int    `json:"id"`
+	} `json:"dungeon"`
+	KeystoneLevel         int          `json:"keystone_level"`
+	Duration              int64        `json:"duration"` // milliseconds
+	CompletedTimestamp    int64        `json:"completed_timestamp"`
+	IsCompletedWithinTime bool         `json:"is_completed_within_time"`
+	MythicRating          MythicRating `json:"mythic_rating"`
+}
+
+// DurationTime returns the run's duration as a time.Duration
+func (r MythicKeystoneRun) DurationTime() time.Duration {
+	return time.Duration(r.Duration) * time.Millisecond
+}
+
+// MythicKeystoneProfile summarizes a character's Mythic+ progress in the current season
+type MythicKeystoneProfile struct {
+	CharacterName string
+	Realm         string
+	CurrentRating float64
+	SeasonID      int // the current season, whether or not the character played it
+	// BestRuns holds the best run per dungeon, highest keystone level first
+	BestRuns []MythicKeystoneRun
+}
+
+// errNoSeasonData signals that a character has no runs recorded for a season
+var errNoSeasonData = errors.New("no mythic keystone data for season")
+
+type mythicKeystoneProfileResponse struct {
+	Character struct {
+		Name  string `json:"name"`
+		Realm Realm  `json:"realm"`
+	} `json:"character"`
+	CurrentMythicRating MythicRating `json:"current_mythic_rating"`
+	Seasons             []struct {
+		ID int `json:"id"`
+	} `json:"seasons"`
+}
+
+type mythicKeystoneSeasonIndexResponse struct {
+	CurrentSeason struct {
+		ID int `json:"id"`
+	} `json:"current_season"`
+}
+
+type mythicKeystoneSeasonResponse struct {
+	BestRuns     []MythicKeystoneRun `json:"best_runs"`
+	MythicRating MythicRating        `json:"mythic_rating"`
+}
+
+// GetCurrentMythicKeystoneSeason returns the ID of the current Mythic+ season
+func (c *BlizzardClient) GetCurrentMythicKeystoneSeason(ctx context.Context) (int, error) {
+	var index mythicKeystoneSeasonIndexResponse
+	err := c.getNamespacedJSON(ctx, EndpointSeasonIndex, "dynamic", "/data/wow/mythic-keystone/season/index", nil, &index)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mythic keystone season index: %w", err)
+	}
+	if index.CurrentSeason.ID == 0 {
+		return 0, fmt.Errorf("mythic keystone season index has no current season")
+	}
+	return index.CurrentSeason.ID, nil
+}
+
+// GetMythicKeystoneProfile returns a character's Mythic+ rating and best run per dungeon
+// in the current season. The rating is 0 if the character has not played the current
+// season. ErrCharacterNotFound is returned if the character does not exist.
+func (c *BlizzardClient) GetMythicKeystoneProfile(ctx context.Context, characterName, realm string) (*MythicKeystoneProfile, error) {
+	basePath, err := c.characterPath(ctx, characterName, realm, "/mythic-keystone-profile")
+	if err != nil {
+		return nil, err
+	}
+
+	var profileResp mythicKeystoneProfileResponse
+	if err := c.getJSON(ctx, EndpointMythicKeystone, basePath, ErrCharacterNotFound, &profileResp); err != nil {
+		return nil, fmt.Errorf("failed to get mythic keystone profile: %w", err)
+	}
+
+	seasonID, err := c.GetCurrentMythicKeystoneSeason(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &MythicKeystoneProfile{
+		CharacterName: profileResp.Character.Name,
+		Realm:         profileResp.Character.Realm.Name,
+		SeasonID:      seasonID,
+	}
+	if profile.CharacterName == "" {
+		profile.CharacterName = characterName
+	}
+	if profile.Realm == "" {
+		profile.Realm = realm
+	}
+
+	played := false
+	for _, season := range profileResp.Seasons {
+		if season.ID == seasonID {
+			played = true
+		}
+	}
+	if !played {
+		// Ratings of earlier seasons are not carried over
+		return profile, nil
+	}
+	profile.CurrentRating = profileResp.CurrentMythicRating.Rating
+
+	var seasonResp mythicKeystoneSeasonResponse
+	seasonPath := fmt.Sprintf("%s/season/%d", basePath, profile.SeasonID)
+	err = c.getJSON(ctx, EndpointMythicKeystone, seasonPath, errNoSeasonData, &seasonResp)
+	if errors.Is(err, errNoSeasonData) {
+		return profile, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mythic keystone season: %w", err)
+	}
+
+	if profile.CurrentRating == 0 {
+		profile.CurrentRating = seasonResp.MythicRating.Rating
+	}
+	profile.BestRuns = bestRunPerDungeon(seasonResp.BestRuns)
+
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Mythic+ profile for %s: rating %.1f, %d dungeons", characterName, profile.CurrentRating, len(profile.BestRuns))
+	}
+	return profile, nil
+}
+
+// bestRunPerDungeon keeps the highest rated run for each dungeon, sorted by keystone level
+func bestRunPerDungeon(runs []MythicKeystoneRun) []MythicKeystoneRun {
+	best := make(map[int]MythicKeystoneRun)
+	for _, run := range runs {
+		current, ok := best[run.Dungeon.ID]
+		if !ok || run.MythicRating.Rating > current.MythicRating.Rating ||
+			(run.MythicRating.Rating == current.MythicRating.Rating && run.KeystoneLevel > current.KeystoneLevel) {
+			best[run.Dungeon.ID] = run
+		}
+	}
+
+	result := make([]MythicKeystoneRun, 0, len(best))
+	for _, run := range best {
+		result = append(result, run)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].KeystoneLevel != result[j].KeystoneLevel {
+			return result[i].KeystoneLevel > result[j].KeystoneLevel
+		}
+		return result[i].Dungeon.Name < result[j].Dungeon.Name
+	})
+	return result
+}
@@ -0,0 +1,105 @@
+package blizzard
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Option configures a BlizzardClient
+type Option func(*BlizzardClient)
+
+// WithHTTPClient makes the client send all requests through the given HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *BlizzardClient) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithOAuthURL overrides the region's OAuth token endpoint
+func WithOAuthURL(oauthURL string) Option {
+	return func(c *BlizzardClient) {
+		c.oauthURL = oauthURL
+	}
+}
+
+// WithAPIBaseURL overrides the region's API host, e.g. to point at a local stand-in server
+func WithAPIBaseURL(apiBaseURL string) Option {
+	return func(c *BlizzardClient) {
+		c.apiBaseURL = apiBaseURL
+	}
+}
+
+// WithLocale overrides the region's default locale of API responses, e.g. de_DE; an
+// empty locale keeps the default
+func WithLocale(locale string) Option {
+	return func(c *BlizzardClient) {
+		c.localeOverride = locale
+	}
+}
+
+// WithRetryPolicy sets how many times failed GET requests are retried and the
+// bounds of the exponential backoff between attempts
+func WithRetryPolicy(maxRetries int, baseBackoff, maxBackoff time.Duration) Option {
+	return func(c *BlizzardClient) {
+		c.retry = retryPolicy{
+			maxRetries:  maxRetries,
+			baseBackoff: baseBackoff,
+			maxBackoff:  maxBackoff,
+		}
+	}
+}
+
+// WithRateLimits overrides the per-second and hourly request quotas
+func WithRateLimits(perSecond, perHour int) Option {
+	return func(c *BlizzardClient) {
+		if perSecond > 0 {
+			c.perSecondLimit = perSecond
+		}
+		if perHour > 0 {
+			c.hourlyLimit = perHour
+		}
+	}
+}
+
+// WithCacheTTL sets how long responses of an endpoint are served from the cache.
+// A TTL of zero disables caching for the endpoint.
+func WithCacheTTL(endpoint Endpoint, ttl time.Duration) Option {
+	return func(c *BlizzardClient) {
+		if c.cacheTTLs == nil {
+			c.cacheTTLs = make(map[Endpoint]time.Duration)
+		}
+		c.cacheTTLs[endpoint] = ttl
+	}
+}
+
+// WithCacheStore persists cached responses in the given store so they survive restarts
+func WithCacheStore(store CacheStore) Option {
+	return func(c *BlizzardClient) {
+		c.cacheStore = store
+	}
+}
+
+// newDefaultHTTPClient returns an HTTP client with a pooled transport and sane timeouts
+func newDefaultHTTPClient() *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   20 * time.Second,
+	}
+}
@@ -0,0 +1,269 @@
+package blizzard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bezerker/sndbot/util"
+	"golang.org/x/text/unicode/norm"
+)
+
+// realmIndexRetryInterval is how long the client falls back to derived slugs after
+// failing to load the realm index before trying again
+const realmIndexRetryInterval = time.Minute
+
+// realmIndexFetchTimeout bounds a realm index request, which is not tied to any caller's context
+const realmIndexFetchTimeout = 30 * time.Second
+
+// maxRealmSuggestions is the number of "did you mean" suggestions offered for unknown realms
+const maxRealmSuggestions = 3
+
+// RealmIndex resolves user input to the realms of a region
+type RealmIndex struct {
+	Realms []Realm `json:"realms"`
+	byKey  map[string]Realm
+}
+
+// newRealmIndex builds the lookup table for a list of realms
+func newRealmIndex(realms []Realm) *RealmIndex {
+	index := &RealmIndex{Realms: realms, byKey: make(map[string]Realm, len(realms)*2)}
+	for _, realm := range realms {
+		index.byKey[RealmKey(realm.Slug)] = realm
+		index.byKey[RealmKey(realm.Name)] = realm
+	}
+	return index
+}
+
+// RealmKey normalises a realm name or slug so that case, spaces, hyphens,
+// apostrophes and accents do not matter, e.g. "Mal'Ganis" and "malganis"
+func RealmKey(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Resolve returns the realm matching the input. A RealmNotFoundError with suggestions
+// is returned if no realm matches.
+func (ri *RealmIndex) Resolve(input string) (Realm, error) {
+	key := RealmKey(input)
+	if realm, ok := ri.byKey[key]; ok && key != "" {
+		return realm, nil
+	}
+	return Realm{}, &RealmNotFoundError{Input: input, Suggestions: ri.suggest(key)}
+}
+
+// suggest returns the names of the realms closest to the normalised input
+func (ri *RealmIndex) suggest(key string) []string {
+	if key == "" {
+		return nil
+	}
+	maxDistance := len([]rune(key)) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, realm := range ri.Realms {
+		distance := levenshtein(key, RealmKey(realm.Name))
+		if slugDistance := levenshtein(key, RealmKey(realm.Slug)); slugDistance < distance {
+			distance = slugDistance
+		}
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{realm.Name, distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxRealmSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+// realmIndexCall tracks a realm index load that is in flight so concurrent callers can
+// share its result
+type realmIndexCall struct {
+	done  chan struct{}
+	index *RealmIndex
+	err   error
+}
+
+// realmResolver loads the realm index once and shares it between requests
+type realmResolver struct {
+	mu         sync.Mutex
+	index      *RealmIndex
+	loadedAt   time.Time
+	lastErr    error
+	failedAt   time.Time
+	refreshTTL time.Duration
+	inflight   *realmIndexCall
+}
+
+// cached returns the index or recent load error to use without contacting the API;
+// ok is false once the index should be (re)loaded
+func (rr *realmResolver) cached() (*RealmIndex, bool, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.index != nil && time.Since(rr.loadedAt) < rr.refreshTTL {
+		return rr.index, true, nil
+	}
+	if rr.lastErr != nil && time.Since(rr.failedAt) < realmIndexRetryInterval {
+		if rr.index != nil {
+			return rr.index, true, nil
+		}
+		return nil, true, rr.lastErr
+	}
+	return nil, false, nil
+}
+
+// GetRealmIndex returns the realms of the client's region. The load is shared between
+// callers and not tied to their contexts, so cancelling ctx only stops this caller from
+// waiting for it.
+func (c *BlizzardClient) GetRealmIndex(ctx context.Context) (*RealmIndex, error) {
+	if index, ok, err := c.realms.cached(); ok {
+		return index, err
+	}
+
+	// Only one caller loads the index; the others wait and reuse it
+	c.realms.mu.Lock()
+	call := c.realms.inflight
+	if call == nil {
+		call = &realmIndexCall{done: make(chan struct{})}
+		c.realms.inflight = call
+		go c.loadRealmIndex(call)
+	}
+	c.realms.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.index, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loadRealmIndex fetches the realm index and records the outcome for later callers
+func (c *BlizzardClient) loadRealmIndex(call *realmIndexCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), realmIndexFetchTimeout)
+	defer cancel()
+	index, err := c.fetchRealmIndex(ctx)
+
+	c.realms.mu.Lock()
+	switch {
+	case err == nil:
+		c.realms.index = index
+		c.realms.loadedAt = time.Now()
+		c.realms.lastErr = nil
+	case c.realms.index != nil:
+		util.Logger.Printf("Failed to refresh realm index, keeping the previous one: %v", err)
+		c.realms.lastErr = err
+		c.realms.failedAt = time.Now()
+		index, err = c.realms.index, nil
+	default:
+		c.realms.lastErr = err
+		c.realms.failedAt = time.Now()
+	}
+	c.realms.inflight = nil
+	c.realms.mu.Unlock()
+
+	call.index, call.err = index, err
+	close(call.done)
+}
+
+func (c *BlizzardClient) fetchRealmIndex(ctx context.Context) (*RealmIndex, error) {
+	path := "/data/wow/realm/index"
+	fullURL := c.apiURL(path, "dynamic")
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Making realm index request to: %s", fullURL)
+	}
+
+	status, body, err := c.getCached(ctx, EndpointRealmIndex, fullURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get realm index: %w", err)
+	}
+	if status != 200 {
+		return nil, newAPIError(status, path, nil)
+	}
+
+	var resp struct {
+		Realms []Realm `json:"realms"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse realm index response: %w", err)
+	}
+	util.Logger.Printf("Loaded %d realms for region %s", len(resp.Realms), c.Region)
+	return newRealmIndex(resp.Realms), nil
+}
+
+// ResolveRealm returns the canonical realm for user input such as "mal'ganis" or
+// "Aerie peak". A RealmNotFoundError is returned if the realm does not exist.
+func (c *BlizzardClient) ResolveRealm(ctx context.Context, input string) (*Realm, error) {
+	index, err := c.GetRealmIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	realm, err := index.Resolve(input)
+	if err != nil {
+		return nil, err
+	}
+	return &realm, nil
+}
+
+// realmSlug resolves user input to a realm slug. If the realm index cannot be loaded
+// the slug is derived from the input instead.
+func (c *BlizzardClient) realmSlug(ctx context.Context, input string) (string, error) {
+	index, err := c.GetRealmIndex(ctx)
+	if err != nil || len(index.Realms) == 0 {
+		if err != nil {
+			util.Logger.Printf("Realm index unavailable, deriving slug for %q: %v", input, err)
+		}
+		return slugify(input), nil
+	}
+	realm, err := index.Resolve(input)
+	if err != nil {
+		return "", err
+	}
+	return realm.Slug, nil
+}
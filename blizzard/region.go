@@ -0,0 +1,90 @@
+package blizzard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region identifies a Battle.net API region
+type Region string
+
+const (
+	RegionUS Region = "us"
+	RegionEU Region = "eu"
+	RegionKR Region = "kr"
+	RegionTW Region = "tw"
+)
+
+// regionSettings holds the endpoints and defaults that differ between regions
+type regionSettings struct {
+	oauthURL      string
+	apiBaseURL    string
+	defaultLocale string
+}
+
+var regions = map[Region]regionSettings{
+	RegionUS: {
+		oauthURL:      "https://us.battle.net/oauth/token",
+		apiBaseURL:    "https://us.api.blizzard.com",
+		defaultLocale: "en_US",
+	},
+	RegionEU: {
+		oauthURL:      "https://eu.battle.net/oauth/token",
+		apiBaseURL:    "https://eu.api.blizzard.com",
+		defaultLocale: "en_GB",
+	},
+	RegionKR: {
+		oauthURL:      "https://kr.battle.net/oauth/token",
+		apiBaseURL:    "https://kr.api.blizzard.com",
+		defaultLocale: "ko_KR",
+	},
+	RegionTW: {
+		oauthURL:      "https://tw.battle.net/oauth/token",
+		apiBaseURL:    "https://tw.api.blizzard.com",
+		defaultLocale: "zh_TW",
+	},
+}
+
+// ParseRegion converts a region name such as "us" or "EU" to a Region.
+// An empty string selects the US region.
+func ParseRegion(name string) (Region, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return RegionUS, nil
+	}
+	region := Region(name)
+	if _, ok := regions[region]; !ok {
+		return "", fmt.Errorf("unsupported Blizzard region %q (expected us, eu, kr or tw)", name)
+	}
+	return region, nil
+}
+
+func (r Region) settings() regionSettings {
+	if s, ok := regions[r]; ok {
+		return s
+	}
+	return regions[RegionUS]
+}
+
+// OAuthURL returns the OAuth token endpoint for the region
+func (r Region) OAuthURL() string {
+	return r.settings().oauthURL
+}
+
+// APIBaseURL returns the game data and profile API host for the region
+func (r Region) APIBaseURL() string {
+	return r.settings().apiBaseURL
+}
+
+// DefaultLocale returns the locale used for API responses in the region
+func (r Region) DefaultLocale() string {
+	return r.settings().defaultLocale
+}
+
+// Namespace returns the API namespace of the given kind (profile, dynamic or static) for the region
+func (r Region) Namespace(kind string) string {
+	if _, ok := regions[r]; !ok {
+		r = RegionUS
+	}
+	return fmt.Sprintf("%s-%s", kind, r)
+}
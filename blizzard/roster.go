@@ -0,0 +1,204 @@
+package blizzard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+// PlayableClass identifies a character class
+type PlayableClass struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// PlayableRace identifies a character race
+type PlayableRace struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// RosterCharacter is the character information included in a guild roster entry
+type RosterCharacter struct {
+	ID            int           `json:"id"`
+	Name          string        `json:"name"`
+	Realm         Realm         `json:"realm"`
+	Level         int           `json:"level"`
+	PlayableClass PlayableClass `json:"playable_class"`
+	PlayableRace  PlayableRace  `json:"playable_race"`
+}
+
+// RosterMember is a single entry of a guild roster
+type RosterMember struct {
+	Character RosterCharacter `json:"character"`
+	Rank      int             `json:"rank"`
+}
+
+// GuildRoster represents the full guild roster response
+type GuildRoster struct {
+	Guild   Guild          `json:"guild"`
+	Members []RosterMember `json:"members"`
+}
+
+// FindMember returns the roster entry for the named character, or nil if the
+// character is not on the roster. An empty realm slug matches any realm.
+func (r *GuildRoster) FindMember(characterName, realmSlug string) *RosterMember {
+	for i := range r.Members {
+		member := &r.Members[i]
+		if !strings.EqualFold(member.Character.Name, characterName) {
+			continue
+		}
+		if realmSlug == "" || member.Character.Realm.Slug == "" || strings.EqualFold(member.Character.Realm.Slug, realmSlug) {
+			return member
+		}
+	}
+	return nil
+}
+
+// classNames maps playable class IDs to names; roster entries only carry the ID
+var classNames = map[int]string{
+	1:  "Warrior",
+	2:  "Paladin",
+	3:  "Hunter",
+	4:  "Rogue",
+	5:  "Priest",
+	6:  "Death Knight",
+	7:  "Shaman",
+	8:  "Mage",
+	9:  "Warlock",
+	10: "Monk",
+	11: "Druid",
+	12: "Demon Hunter",
+	13: "Evoker",
+}
+
+// raceNames maps playable race IDs to names; roster entries only carry the ID
+var raceNames = map[int]string{
+	1:  "Human",
+	2:  "Orc",
+	3:  "Dwarf",
+	4:  "Night Elf",
+	5:  "Undead",
+	6:  "Tauren",
+	7:  "Gnome",
+	8:  "Troll",
+	9:  "Goblin",
+	10: "Blood Elf",
+	11: "Draenei",
+	22: "Worgen",
+	24: "Pandaren",
+	25: "Pandaren",
+	26: "Pandaren",
+	27: "Nightborne",
+	28: "Highmountain Tauren",
+	29: "Void Elf",
+	30: "Lightforged Draenei",
+	31: "Zandalari Troll",
+	32: "Kul Tiran",
+	34: "Dark Iron Dwarf",
+	35: "Vulpera",
+	36: "Mag'har Orc",
+	37: "Mechagnome",
+	52: "Dracthyr",
+	70: "Dracthyr",
+	84: "Earthen",
+	85: "Earthen",
+}
+
+// ClassName returns the name of the playable class with the given ID
+func ClassName(classID int) string {
+	if name, ok := classNames[classID]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// ClassID returns the ID of the playable class with the given English name, ignoring case
+func ClassID(name string) (int, bool) {
+	for id, className := range classNames {
+		if strings.EqualFold(className, name) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// RaceName returns the name of the playable race with the given ID
+func RaceName(raceID int) string {
+	if name, ok := raceNames[raceID]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// slugify converts a realm or guild name to the slug format used in API paths
+func slugify(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "-"))
+}
+
+// GuildSlug returns the slug of a guild name as used in guild API paths
+func GuildSlug(name string) string {
+	return slugify(name)
+}
+
+// GetGuildRoster returns every member of a guild with their level, class, race and rank.
+// ErrGuildNotFound is returned if the guild does not exist.
+func (c *BlizzardClient) GetGuildRoster(ctx context.Context, realmSlug, guildSlug string) (*GuildRoster, error) {
+	realmSlug, err := c.realmSlug(ctx, realmSlug)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/data/wow/guild/%s/%s/roster", url.PathEscape(realmSlug), url.PathEscape(guildSlug))
+	fullURL := c.apiURL(path, "profile")
+
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Making guild roster request to: %s", fullURL)
+		util.Logger.Printf("Debug info - Realm slug: %s, Guild slug: %s", realmSlug, guildSlug)
+	}
+
+	status, body, err := c.getCached(ctx, EndpointGuildRoster, fullURL)
+	if err != nil {
+		util.Logger.Printf("Error making request: %v", err)
+		return nil, fmt.Errorf("failed to get guild roster: %w", err)
+	}
+
+	if status != 200 {
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("API request failed with status %d. Response body: %s", status, string(body))
+		}
+		if status == 404 {
+			util.Logger.Printf("Guild not found: realm=%s, guild=%s", realmSlug, guildSlug)
+			return nil, newAPIError(status, path, ErrGuildNotFound)
+		}
+		return nil, newAPIError(status, path, nil)
+	}
+
+	var roster GuildRoster
+	if err := json.Unmarshal(body, &roster); err != nil {
+		util.Logger.Printf("Error parsing guild roster response: %v", err)
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Response body: %s", string(body))
+		}
+		return nil, fmt.Errorf("failed to parse guild roster response: %w", err)
+	}
+
+	for i := range roster.Members {
+		character := &roster.Members[i].Character
+		if character.PlayableClass.Name == "" {
+			character.PlayableClass.Name = ClassName(character.PlayableClass.ID)
+		}
+		if character.PlayableRace.Name == "" {
+			character.PlayableRace.Name = RaceName(character.PlayableRace.ID)
+		}
+	}
+
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Guild roster response - Members count: %d", len(roster.Members))
+	}
+
+	return &roster, nil
+}
@@ -0,0 +1,180 @@
+package blizzard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bezerker/sndbot/util"
+)
+
+// tokenRefreshWindow is how long before expiry a token is proactively refreshed. Tokens
+// with a short lifetime are refreshed halfway through it instead.
+const tokenRefreshWindow = 5 * time.Minute
+
+// tokenFetchTimeout bounds a single token request, which is not tied to any caller's context
+const tokenFetchTimeout = 30 * time.Second
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// tokenCall tracks a token fetch that is in flight so concurrent callers can share its result
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// tokenProvider fetches and caches OAuth client credentials tokens. It is safe for
+// concurrent use and ensures at most one token request is in flight at a time.
+type tokenProvider struct {
+	clientID     string
+	clientSecret string
+	oauthURL     string
+	httpClient   *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiry    time.Time
+	refreshAt time.Time
+	inflight  *tokenCall
+}
+
+func newTokenProvider(clientID, clientSecret, oauthURL string, httpClient *http.Client) *tokenProvider {
+	return &tokenProvider{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		oauthURL:     oauthURL,
+		httpClient:   httpClient,
+	}
+}
+
+// Token returns a valid access token, fetching a new one if needed. When the cached
+// token is about to expire it is still returned while a refresh runs in the background.
+// The fetch itself is shared between callers, so cancelling ctx only stops this caller
+// from waiting for it.
+func (p *tokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	now := time.Now()
+
+	if p.token != "" && now.Before(p.expiry) {
+		token := p.token
+		if now.After(p.refreshAt) && p.inflight == nil {
+			util.Logger.Printf("Access token expires in %v, refreshing in the background", p.expiry.Sub(now))
+			call := p.startFetch()
+			p.mu.Unlock()
+			go p.runFetch(call)
+			return token, nil
+		}
+		p.mu.Unlock()
+		return token, nil
+	}
+
+	call := p.inflight
+	if call == nil {
+		call = p.startFetch()
+		go p.runFetch(call)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate discards the given token if it is still the cached one, forcing the next
+// call to Token to fetch a new one. Tokens refreshed in the meantime are kept.
+func (p *tokenProvider) Invalidate(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == token {
+		util.Logger.Print("Invalidating rejected access token")
+		p.token = ""
+		p.expiry = time.Time{}
+		p.refreshAt = time.Time{}
+	}
+}
+
+// startFetch registers a new in-flight fetch; the caller must hold p.mu
+func (p *tokenProvider) startFetch() *tokenCall {
+	call := &tokenCall{done: make(chan struct{})}
+	p.inflight = call
+	return call
+}
+
+func (p *tokenProvider) runFetch(call *tokenCall) {
+	token, lifetime, err := p.fetch()
+
+	p.mu.Lock()
+	if err == nil {
+		p.token = token
+		p.expiry = time.Now().Add(lifetime)
+		p.refreshAt = p.expiry.Add(-min(tokenRefreshWindow, lifetime/2))
+	}
+	p.inflight = nil
+	p.mu.Unlock()
+
+	call.token, call.err = token, err
+	close(call.done)
+}
+
+// fetch requests a new token and returns it with its lifetime
+func (p *tokenProvider) fetch() (string, time.Duration, error) {
+	util.Logger.Print("Getting new Blizzard API access token")
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.oauthURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		util.Logger.Printf("Error getting access token: %v", err)
+		return "", 0, fmt.Errorf("failed to get token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		util.Logger.Printf("Error reading token response: %v", err)
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		util.Logger.Printf("Token request failed with status %d. Response body: %s", resp.StatusCode, string(body))
+		return "", 0, newAPIError(resp.StatusCode, req.URL.Path, nil)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		util.Logger.Printf("Error parsing token response: %v\nResponse body: %s", err, string(body))
+		return "", 0, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response did not contain an access token")
+	}
+
+	util.Logger.Printf("Successfully obtained new access token (expires in %d seconds)", token.ExpiresIn)
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
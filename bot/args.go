@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// closingQuotes maps the quote characters accepted around an argument to their closing
+// counterpart; Discord clients on phones often insert curly quotes
+var closingQuotes = map[rune]rune{
+	'"': '"',
+	'“': '”',
+	'„': '“',
+}
+
+// splitArgs splits a command message into arguments. Text in double quotes forms a single
+// argument so that realms with spaces can be entered, e.g. !register Name "Area 52".
+// Apostrophes are left alone because realm names such as Mal'Ganis contain them.
+func splitArgs(content string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var closing rune
+
+	for _, r := range content {
+		switch {
+		case closing != 0:
+			if r == closing {
+				closing = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case closingQuotes[r] != 0:
+			closing = closingQuotes[r]
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if closing != 0 {
+		return nil, fmt.Errorf("missing closing quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// parseCharacter reads a character and realm from command arguments. It accepts
+// "<name> <realm>" where the realm may span several words, "Name-Realm" and links to
+// a character's armory, Raider.IO or Warcraft Logs page.
+func parseCharacter(args []string) (string, string, bool) {
+	if len(args) == 0 {
+		return "", "", false
+	}
+
+	if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+		if len(args) > 1 {
+			return "", "", false
+		}
+		return parseCharacterURL(args[0])
+	}
+
+	// Character names cannot contain hyphens, so the first one separates name and realm
+	if name, realm, found := strings.Cut(args[0], "-"); found {
+		realm = strings.TrimSpace(strings.Join(append([]string{realm}, args[1:]...), " "))
+		if name == "" || realm == "" {
+			return "", "", false
+		}
+		return name, realm, true
+	}
+
+	if len(args) < 2 {
+		return "", "", false
+	}
+	return args[0], strings.Join(args[1:], " "), true
+}
+
+// parseCharacterURL extracts the character and realm from a profile link such as
+// https://worldofwarcraft.blizzard.com/en-us/character/us/area-52/name. The realm is
+// returned as its slug.
+func parseCharacterURL(link string) (string, string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", "", false
+	}
+
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if segment != "character" && segment != "characters" {
+			continue
+		}
+		// Path continues with region, realm and name
+		if i+3 >= len(segments) {
+			return "", "", false
+		}
+		realm, err := url.PathUnescape(segments[i+2])
+		if err != nil {
+			return "", "", false
+		}
+		name, err := url.PathUnescape(segments[i+3])
+		if err != nil || realm == "" || name == "" {
+			return "", "", false
+		}
+		return name, realm, true
+	}
+	return "", "", false
+}
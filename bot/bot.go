@@ -1,11 +1,15 @@
 package bot
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bezerker/sndbot/blizzard"
 	config "github.com/bezerker/sndbot/config"
@@ -18,8 +22,43 @@ var (
 	db          *sql.DB
 	blizzardAPI BlizzardAPI
 	cfg         config.Config
+	// botCtx is cancelled when the bot shuts down, aborting in-flight command work
+	botCtx = context.Background()
+	// handlers tracks in-flight event handlers so shutdown can wait for them. New handlers
+	// are only added through startHandler, which refuses them once shutdown has begun.
+	handlers     sync.WaitGroup
+	handlersMu   sync.Mutex
+	shuttingDown bool
 )
 
+// defaultCommandTimeout bounds how long a command may spend on external calls
+const defaultCommandTimeout = 15 * time.Second
+
+// shutdownTimeout bounds how long shutdown waits for in-flight handlers
+const shutdownTimeout = 10 * time.Second
+
+// describeBlizzardError turns an error from the Blizzard API into a user-facing explanation
+func describeBlizzardError(err error) string {
+	var realmErr *blizzard.RealmNotFoundError
+	switch {
+	case errors.As(err, &realmErr):
+		if len(realmErr.Suggestions) > 0 {
+			return fmt.Sprintf("realm %s was not found, did you mean %s?", realmErr.Input, strings.Join(realmErr.Suggestions, " or "))
+		}
+		return fmt.Sprintf("realm %s was not found, please check the spelling", realmErr.Input)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the Blizzard API did not respond in time, please try again later"
+	case errors.Is(err, context.Canceled):
+		return "the bot is shutting down, please try again shortly"
+	case errors.Is(err, blizzard.ErrRateLimited):
+		return "the Blizzard API is rate limiting requests, please try again in a minute"
+	case errors.Is(err, blizzard.ErrUnauthorized):
+		return "the bot's Blizzard API credentials were rejected, please contact an admin"
+	default:
+		return err.Error()
+	}
+}
+
 // Initialize the bot with the given configuration
 func Initialize(config config.Config) {
 	cfg = config
@@ -44,64 +83,215 @@ func hasAnyRole(member *discordgo.Member, roles []string) bool {
 	return false
 }
 
-// updateMemberRoles handles role assignments based on character verification and guild membership
-func updateMemberRoles(s DiscordSession, guildID string, member *discordgo.Member, characterExists bool, isInGuild bool) (string, error) {
+// guildRank looks up a guild member's rank index for the rank role mapping and role
+// rules. It returns -1 when neither uses ranks or the rank could not be determined.
+func guildRank(ctx context.Context, characterName, realm string) int {
+	if !guildsUseRanks() && !rulesUse(func(r config.RoleRule) bool { return r.MaxGuildRank != nil }) {
+		return -1
+	}
+	guildInfo, err := blizzardAPI.GetGuildInfo(ctx, characterName, realm)
+	if err != nil {
+		util.Logger.Printf("Error getting guild rank for %s on %s: %v", characterName, realm, err)
+		return -1
+	}
+	if guildInfo == nil {
+		return -1
+	}
+	return guildInfo.Rank
+}
+
+// updateMemberRoles handles role assignments based on character verification, membership of a
+// tracked guild (nil if none) and, when facts are given, the role rules, and describes the
+// changes for the user
+func updateMemberRoles(s DiscordSession, guildID string, member *discordgo.Member, characterExists bool, guild *config.TrackedGuild, rank int, facts *ruleFacts) (string, error) {
 	if !characterExists {
 		return "", nil // Do nothing if character doesn't exist
 	}
 
-	var roleUpdates []string
+	granted, removed, err := grantMemberRoles(s, guildID, member, guild, rank)
+	if err != nil {
+		return "", err
+	}
+	// Drop the roles of guilds a previously registered character was in
+	left, err := revokeMemberRoles(s, guildID, member, guild, false)
+	if err != nil {
+		return "", err
+	}
+	removed = append(removed, left...)
+	if facts != nil {
+		ruleGranted, ruleRemoved, err := applyRoleRules(s, guildID, member, facts)
+		if err != nil {
+			return "", err
+		}
+		granted = append(granted, ruleGranted...)
+		removed = append(removed, ruleRemoved...)
+	}
 
-	// Check if member already has the community role
-	hasCommunityRole := false
-	for _, role := range member.Roles {
-		if role == cfg.CommunityRoleID {
-			hasCommunityRole = true
-			break
+	if len(removed) > 0 {
+		msg := fmt.Sprintf("Removed roles: %s", strings.Join(removed, ", "))
+		if len(granted) > 0 {
+			msg = fmt.Sprintf("Granted roles: %s\n%s", strings.Join(granted, ", "), msg)
 		}
+		return msg, nil
 	}
 
-	// Add community role if character exists and user doesn't have it yet
-	if !hasCommunityRole {
+	if len(granted) == 0 {
+		if guild != nil {
+			return "No new roles needed - you already have all applicable roles (Community and Guild Member)", nil
+		}
+		return "No new roles needed - you already have all applicable roles (Community)", nil
+	}
+
+	return fmt.Sprintf("Granted roles: %s", strings.Join(granted, ", ")), nil
+}
+
+// grantMemberRoles grants the community role to a member whose character exists, and the
+// guild's roles to members of a tracked guild. Members whose rank is mapped in the guild's
+// RankRoleIDs get that rank's role, replacing any other rank role of the guild they hold.
+// Unmapped ranks lose their rank roles and get the guild's entry level member role, which
+// unknown ranks (-1) only get if they hold no role of the guild. It returns the labels of
+// the roles granted and removed.
+func grantMemberRoles(s DiscordSession, guildID string, member *discordgo.Member, guild *config.TrackedGuild, rank int) ([]string, []string, error) {
+	var granted, removed []string
+
+	// Add community role if the user doesn't have it yet
+	if !hasAnyRole(member, []string{cfg.CommunityRoleID}) {
 		if util.IsDebugEnabled() {
 			util.Logger.Printf("Adding community role to user %s", member.User.Username)
 		}
 		err := s.GuildMemberRoleAdd(guildID, member.User.ID, cfg.CommunityRoleID)
 		if err != nil {
-			return "", fmt.Errorf("failed to add community role: %v", err)
+			return nil, nil, fmt.Errorf("failed to add community role: %v", err)
+		}
+		granted = append(granted, "Community Role")
+	}
+	if guild == nil {
+		return granted, removed, nil
+	}
+
+	rankRole, hasRankRole := guild.RankRoleIDs[rank]
+
+	// A known rank replaces the roles of other ranks after a promotion or demotion, also
+	// when the new rank has no role of its own. Unknown ranks leave rank roles alone,
+	// since the rank lookup may just have failed.
+	if rank >= 0 {
+		for _, role := range rankRoleIDs(guild) {
+			if (hasRankRole && role == rankRole) || (!hasRankRole && containsString(guild.MemberRoleIDs, role)) {
+				continue
+			}
+			if !hasAnyRole(member, []string{role}) {
+				continue
+			}
+			if util.IsDebugEnabled() {
+				util.Logger.Printf("Removing previous rank role %s from user %s", role, member.User.Username)
+			}
+			err := s.GuildMemberRoleRemove(guildID, member.User.ID, role)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to remove previous rank role: %v", err)
+			}
+			removed = append(removed, "Previous Guild Rank Role")
 		}
-		roleUpdates = append(roleUpdates, "Community Role")
 	}
 
-	// If character is in guild and doesn't have any guild roles, add entry level role
-	if isInGuild && !hasAnyRole(member, cfg.GuildMemberRoleIDs) {
+	// Members without a rank role need one of the guild's member roles; with an unknown
+	// rank any role of the guild will do
+	needsMemberRole := !hasAnyRole(member, guildRoleIDs(guild))
+	if rank >= 0 {
+		needsMemberRole = !hasAnyRole(member, guild.MemberRoleIDs)
+	}
+
+	switch {
+	case hasRankRole:
+		if !hasAnyRole(member, []string{rankRole}) {
+			if util.IsDebugEnabled() {
+				util.Logger.Printf("Adding %s rank %d role to user %s", guild.Name, rank, member.User.Username)
+			}
+			err := s.GuildMemberRoleAdd(guildID, member.User.ID, rankRole)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to add guild rank role: %v", err)
+			}
+			granted = append(granted, fmt.Sprintf("Guild Rank %d Role", rank))
+		}
+
+	// Otherwise add the guild's entry level role
+	case len(guild.MemberRoleIDs) > 0 && needsMemberRole:
 		if util.IsDebugEnabled() {
-			util.Logger.Printf("Adding guild member role to user %s", member.User.Username)
+			util.Logger.Printf("Adding %s member role to user %s", guild.Name, member.User.Username)
 		}
-		err := s.GuildMemberRoleAdd(guildID, member.User.ID, cfg.GuildMemberRoleIDs[0])
+		err := s.GuildMemberRoleAdd(guildID, member.User.ID, guild.MemberRoleIDs[0])
 		if err != nil {
-			return "", fmt.Errorf("failed to add guild role: %v", err)
+			return nil, nil, fmt.Errorf("failed to add guild role: %v", err)
 		}
-		roleUpdates = append(roleUpdates, "Guild Member Role")
+		granted = append(granted, "Guild Member Role")
 	}
 
-	if len(roleUpdates) == 0 {
-		if isInGuild {
-			return "No new roles needed - you already have all applicable roles (Community and Guild Member)", nil
+	return granted, removed, nil
+}
+
+// revokeMemberRoles removes the member and rank roles of every tracked guild from a
+// member, except the roles of the guild to keep (nil for none). The community and role
+// rule roles are removed as well when includeCommunity is set. It returns the labels of
+// the roles removed.
+func revokeMemberRoles(s DiscordSession, guildID string, member *discordgo.Member, keep *config.TrackedGuild, includeCommunity bool) ([]string, error) {
+	type labelledRole struct{ id, label string }
+	var roles []labelledRole
+	if includeCommunity && cfg.CommunityRoleID != "" {
+		roles = append(roles, labelledRole{cfg.CommunityRoleID, "Community Role"})
+	}
+	for _, guild := range cfg.Guilds() {
+		for _, role := range guild.MemberRoleIDs {
+			roles = append(roles, labelledRole{role, "Guild Member Role"})
+		}
+		for _, role := range rankRoleIDs(&guild) {
+			roles = append(roles, labelledRole{role, "Guild Rank Role"})
+		}
+	}
+	if includeCommunity {
+		for _, rule := range cfg.RoleRules {
+			roles = append(roles, labelledRole{rule.RoleID, rule.Name})
+		}
+	}
+
+	seen := make(map[string]bool)
+	if keep != nil {
+		for _, role := range guildRoleIDs(keep) {
+			seen[role] = true
 		}
-		return "No new roles needed - you already have all applicable roles (Community)", nil
 	}
 
-	return fmt.Sprintf("Granted roles: %s", strings.Join(roleUpdates, ", ")), nil
+	var removed []string
+	for _, role := range roles {
+		if seen[role.id] || !hasAnyRole(member, []string{role.id}) {
+			continue
+		}
+		seen[role.id] = true
+		if util.IsDebugEnabled() {
+			util.Logger.Printf("Removing role %s from user %s", role.id, member.User.Username)
+		}
+		if err := s.GuildMemberRoleRemove(guildID, member.User.ID, role.id); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %v", strings.ToLower(role.label), err)
+		}
+		removed = append(removed, role.label)
+	}
+	return removed, nil
 }
 
 // DiscordSession is an interface that defines the methods we need from discordgo.Session
 type DiscordSession interface {
 	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
 	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
 	GetState() *discordgo.State
 	GuildMember(guildID, userID string) (*discordgo.Member, error)
+	GuildMembersSearch(guildID, query string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error)
 	GuildMemberRoleAdd(guildID, userID, roleID string) error
+	GuildMemberRoleRemove(guildID, userID, roleID string) error
+	GuildMemberNickname(guildID, userID, nickname string, options ...discordgo.RequestOption) error
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
 }
 
 // DiscordWrapper wraps a discordgo.Session to implement our interface
@@ -121,13 +311,28 @@ func (w *DiscordWrapper) GuildMemberRoleAdd(guildID, userID, roleID string) erro
 	return w.Session.GuildMemberRoleAdd(guildID, userID, roleID)
 }
 
+func (w *DiscordWrapper) GuildMemberRoleRemove(guildID, userID, roleID string) error {
+	return w.Session.GuildMemberRoleRemove(guildID, userID, roleID)
+}
+
+// quotaReporter is implemented by Blizzard clients that track API quota usage
+type quotaReporter interface {
+	QuotaUsage() blizzard.QuotaUsage
+}
+
 // BlizzardAPI is an interface for the Blizzard API client
 type BlizzardAPI interface {
-	CharacterExists(characterName, realm string) (bool, error)
-	IsCharacterInGuild(characterName, realm string, guildID int) (bool, error)
-	GetCharacterGuild(characterName, realm string) (*blizzard.Guild, error)
-	GetGuildInfo(characterName, realm string) (*blizzard.GuildInfo, error)
-	GetGuildMemberInfo(characterName, realmSlug, guildName string) (*blizzard.GuildMember, error)
+	CharacterExists(ctx context.Context, characterName, realm string) (bool, error)
+	GetCharacterGuild(ctx context.Context, characterName, realm string) (*blizzard.Guild, error)
+	GetGuildInfo(ctx context.Context, characterName, realm string) (*blizzard.GuildInfo, error)
+	GetGuildRoster(ctx context.Context, realmSlug, guildSlug string) (*blizzard.GuildRoster, error)
+	GetMythicKeystoneProfile(ctx context.Context, characterName, realm string) (*blizzard.MythicKeystoneProfile, error)
+	GetRaidEncounters(ctx context.Context, characterName, realm string) (*blizzard.RaidEncounters, error)
+	GetCurrentRaidTier(ctx context.Context) (*blizzard.RaidTier, error)
+	GetCharacterSummary(ctx context.Context, characterName, realm string) (*blizzard.CharacterSummary, error)
+	GetCharacterEquipment(ctx context.Context, characterName, realm string) (*blizzard.CharacterEquipment, error)
+	GetCharacterMedia(ctx context.Context, characterName, realm string) (*blizzard.CharacterMedia, error)
+	GetCharacterAchievements(ctx context.Context, characterName, realm string) (*blizzard.CharacterAchievements, error)
 }
 
 func RunBot(config config.Config) {
@@ -141,8 +346,17 @@ func RunBot(config config.Config) {
 	util.Logger.Print("Starting bot...")
 
 	// Initialize configuration
+	if err := validateRoleRules(config.RoleRules); err != nil {
+		util.Logger.Printf("Invalid ROLE_RULES: %v", err)
+		return
+	}
 	Initialize(config)
 
+	// Cancel in-flight command work when the bot shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	botCtx = ctx
+
 	// Initialize database
 	var err error
 	db, err = database.InitDB(config.DBPath)
@@ -153,7 +367,19 @@ func RunBot(config config.Config) {
 	defer db.Close()
 
 	// Initialize Blizzard API client
-	blizzardAPI = blizzard.NewBlizzardClient(config.BlizzardClientID, config.BlizzardSecret)
+	region, err := blizzard.ParseRegion(config.BlizzardRegion)
+	if err != nil {
+		util.Logger.Printf("Invalid Blizzard region: %v", err)
+		return
+	}
+	clientOpts := []blizzard.Option{blizzard.WithLocale(config.BlizzardLocale)}
+	if config.PersistAPICache {
+		if err := database.PurgeAPICache(db, time.Now().Add(-apiCacheRetention)); err != nil {
+			util.Logger.Printf("Failed to purge API cache: %v", err)
+		}
+		clientOpts = append(clientOpts, blizzard.WithCacheStore(dbCacheStore{db: db}))
+	}
+	blizzardAPI = blizzard.NewBlizzardClient(config.BlizzardClientID, config.BlizzardSecret, region, clientOpts...)
 
 	BotToken := config.DiscordToken
 	// create a session
@@ -164,14 +390,49 @@ func RunBot(config config.Config) {
 
 	// add a event handler
 	discord.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		if !startHandler() {
+			return
+		}
+		defer handlers.Done()
 		newMessage(wrapper, m)
 	})
+	discord.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !startHandler() {
+			return
+		}
+		defer handlers.Done()
+		newInteraction(wrapper, i)
+	})
+	discord.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+		if !startHandler() {
+			return
+		}
+		defer handlers.Done()
+		handleMemberJoin(wrapper, m)
+	})
+	discord.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+		if !startHandler() {
+			return
+		}
+		defer handlers.Done()
+		handleMemberLeave(wrapper, m)
+	})
+	// Member join and leave events need the privileged Server Members intent, which must also be
+	// enabled for the bot in the Discord developer portal
+	discord.Identify.Intents |= discordgo.IntentsGuildMembers
 
 	// open the connection
 	err = discord.Open()
 	util.CheckNilErr(err)
 	defer discord.Close()
 
+	if err := registerSlashCommands(wrapper, discord.State.User.ID); err != nil {
+		util.Logger.Printf("Error: %v", err)
+	}
+
+	startReconciler(ctx, wrapper)
+	startDeparturePurger(ctx)
+
 	fmt.Println("Bot is running!")
 
 	// Wait for a signal to quit
@@ -179,115 +440,171 @@ func RunBot(config config.Config) {
 	signal.Notify(stop, os.Interrupt)
 	<-stop
 	fmt.Println("Graceful shutdown")
+
+	cancel()
+	waitForHandlers(shutdownTimeout)
+}
+
+// startHandler registers an in-flight handler, which must call handlers.Done when it
+// finishes. It returns false once shutdown has begun, when the handler must not run.
+func startHandler() bool {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if shuttingDown {
+		return false
+	}
+	handlers.Add(1)
+	return true
 }
 
-func handleAdminCommands(discord DiscordSession, message *discordgo.MessageCreate, args []string) {
-	// Only process admin commands in DMs
-	channel, err := discord.Channel(message.ChannelID)
+// waitForHandlers stops new handlers from starting and waits for in-flight ones to
+// finish, up to the given timeout
+func waitForHandlers(timeout time.Duration) {
+	handlersMu.Lock()
+	shuttingDown = true
+	handlersMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		util.Logger.Printf("Timed out after %v waiting for in-flight handlers", timeout)
+	}
+}
+
+func handleAddAdmin(c *commandContext) {
+	targetUser := c.params["discord_username"]
+	err := database.AddAdmin(db, targetUser)
 	if err != nil {
-		util.Logger.Printf("Error getting channel info: %v", err)
+		c.reply(fmt.Sprintf("Error adding admin: %v", err))
 		return
 	}
+	c.reply(fmt.Sprintf("Successfully added %s as admin", targetUser))
+}
 
-	if channel.Type != discordgo.ChannelTypeDM {
+func handleRemoveAdmin(c *commandContext) {
+	targetUser := c.params["discord_username"]
+	err := database.RemoveAdmin(db, targetUser)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error removing admin: %v", err))
 		return
 	}
+	c.reply(fmt.Sprintf("Successfully removed %s as admin", targetUser))
+}
 
-	isAdmin, err := database.IsAdmin(db, message.Author.Username)
+func handleRegisterUser(c *commandContext) {
+	username, characterName, server := c.params["discord_username"], c.params["character"], c.params["realm"]
+	registration := database.CharacterRegistration{
+		DiscordUsername: username,
+		CharacterName:   characterName,
+		Server:          server,
+	}
+	err := database.RegisterCharacter(db, registration)
 	if err != nil {
-		util.Logger.Printf("Error checking admin status: %v", err)
-		discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error checking admin status: %v", err))
+		c.reply(fmt.Sprintf("Error registering character: %v", err))
 		return
 	}
+	c.reply(fmt.Sprintf("Successfully registered character %s on server %s for %s", characterName, server, username))
+}
 
-	if !isAdmin {
+func handleRemoveUser(c *commandContext) {
+	username := c.params["discord_username"]
+	reg, err := database.GetCharacter(db, username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error removing registration: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply(fmt.Sprintf("No registration found for %s", username))
 		return
 	}
 
-	switch args[0] {
-	case "!addadmin":
-		if len(args) != 2 {
-			discord.ChannelMessageSend(message.ChannelID, "Usage: !addadmin <discord_username>")
-			return
-		}
-		targetUser := args[1]
-		err := database.AddAdmin(db, targetUser)
-		if err != nil {
-			discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error adding admin: %v", err))
-			return
-		}
-		discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Successfully added %s as admin", targetUser))
+	if err := database.RemoveCharacterRegistration(db, username); err != nil {
+		c.reply(fmt.Sprintf("Error removing registration: %v", err))
+		return
+	}
 
-	case "!removeadmin":
-		if len(args) != 2 {
-			discord.ChannelMessageSend(message.ChannelID, "Usage: !removeadmin <discord_username>")
-			return
-		}
-		targetUser := args[1]
-		err := database.RemoveAdmin(db, targetUser)
-		if err != nil {
-			discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error removing admin: %v", err))
-			return
-		}
-		discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Successfully removed %s as admin", targetUser))
+	removed, err := stripRegistrationRoles(c.session, cfg.DiscordGuildID, reg)
+	switch {
+	case err != nil:
+		c.reply(fmt.Sprintf("Removed registration for %s, but there was an error removing roles: %v", username, err))
+	case cfg.DiscordGuildID == "":
+		c.reply(fmt.Sprintf("Successfully removed registration for %s (roles unchanged, DISCORD_GUILD_ID is not configured)", username))
+	case len(removed) > 0:
+		c.reply(fmt.Sprintf("Successfully removed registration for %s\nRemoved roles: %s", username, strings.Join(removed, ", ")))
+	default:
+		c.reply(fmt.Sprintf("Successfully removed registration for %s", username))
+	}
+}
 
-	case "!register-user":
-		if len(args) != 4 {
-			discord.ChannelMessageSend(message.ChannelID, "Usage: !register-user <discord_username> <character_name> <server>")
-			return
-		}
-		registration := database.CharacterRegistration{
-			DiscordUsername: args[1],
-			CharacterName:   args[2],
-			Server:          args[3],
-		}
-		err := database.RegisterCharacter(db, registration)
-		if err != nil {
-			discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error registering character: %v", err))
-			return
-		}
-		discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Successfully registered character %s on server %s for %s", args[2], args[3], args[1]))
+func handleUnregister(c *commandContext) {
+	reg, err := database.GetCharacter(db, c.user.Username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply("You don't have a registered character.")
+		return
+	}
+	reg.DiscordUserID = c.user.ID
 
-	case "!remove-user":
-		if len(args) != 2 {
-			discord.ChannelMessageSend(message.ChannelID, "Usage: !remove-user <discord_username>")
-			return
-		}
-		err := database.RemoveCharacterRegistration(db, args[1])
-		if err != nil {
-			discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error removing registration: %v", err))
-			return
-		}
-		discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Successfully removed registration for %s", args[1]))
+	// Strip roles in the server the command was sent from, or the configured one in DMs
+	guildID := cfg.DiscordGuildID
+	if channel, err := c.session.Channel(c.channelID); err == nil && channel.GuildID != "" {
+		guildID = channel.GuildID
+	}
 
-	case "!list-users":
-		registrations, err := database.GetAllRegistrations(db)
-		if err != nil {
-			discord.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error getting registrations: %v", err))
-			return
-		}
-		if len(registrations) == 0 {
-			discord.ChannelMessageSend(message.ChannelID, "No registered users found")
-			return
-		}
+	if err := database.RemoveCharacterRegistration(db, reg.DiscordUsername); err != nil {
+		c.reply(fmt.Sprintf("Failed to unregister character: %v", err))
+		return
+	}
 
-		var response strings.Builder
-		response.WriteString("Registered users:\n")
-		for _, reg := range registrations {
-			response.WriteString(fmt.Sprintf("- %s: %s on %s\n", reg.DiscordUsername, reg.CharacterName, reg.Server))
-		}
-		discord.ChannelMessageSend(message.ChannelID, response.String())
+	removed, err := stripRegistrationRoles(c.session, guildID, reg)
+	switch {
+	case err != nil:
+		c.reply(fmt.Sprintf("Unregistered character %s on server %s, but there was an error removing roles: %v", reg.CharacterName, reg.Server, err))
+	case guildID == "":
+		c.reply(fmt.Sprintf("Unregistered character %s on server %s (your roles were not removed because no Discord server is configured for DMs, ask an admin to remove them)", reg.CharacterName, reg.Server))
+	case len(removed) > 0:
+		c.reply(fmt.Sprintf("Unregistered character %s on server %s\nRemoved roles: %s", reg.CharacterName, reg.Server, strings.Join(removed, ", ")))
+	default:
+		c.reply(fmt.Sprintf("Unregistered character %s on server %s", reg.CharacterName, reg.Server))
+	}
+}
 
-	case "!admin-help":
-		helpMessage := `Available admin commands (DM only):
-!admin-help - Show this help message
-!addadmin <discord_username> - Add a new admin
-!removeadmin <discord_username> - Remove an admin
-!register-user <discord_username> <character_name> <server> - Register a character for a user
-!remove-user <discord_username> - Remove a user's registration
-!list-users - List all registered users`
-		discord.ChannelMessageSend(message.ChannelID, helpMessage)
+// stripRegistrationRoles removes the community, guild member and rank roles the bot
+// grants from a registered user. Roles are left alone when the Discord server is unknown
+// or the user is not a member of it.
+func stripRegistrationRoles(s DiscordSession, guildID string, reg *database.CharacterRegistration) ([]string, error) {
+	if guildID == "" {
+		return nil, nil
+	}
+	member := findRegisteredMember(s, guildID, *reg)
+	if member == nil {
+		return nil, nil
 	}
+	return revokeMemberRoles(s, guildID, member, nil, true)
+}
+
+func handleAPIQuota(c *commandContext) {
+	reporter, ok := blizzardAPI.(quotaReporter)
+	if !ok {
+		c.reply("Quota usage is not available for this Blizzard client")
+		return
+	}
+	usage := reporter.QuotaUsage()
+	quotaMsg := fmt.Sprintf("Blizzard API quota usage:\nHourly: %d/%d used (%d remaining)\nPer-second limit: %d\nRequests sent: %d\nRetries: %d\nRate limited responses: %d",
+		usage.HourlyUsed(), usage.HourlyLimit, usage.HourlyRemaining, usage.PerSecondLimit, usage.TotalRequests, usage.Retries, usage.RateLimited)
+	if time.Now().Before(usage.BlockedUntil) {
+		quotaMsg += fmt.Sprintf("\nBlocked by Retry-After for another %v", time.Until(usage.BlockedUntil).Round(time.Second))
+	}
+	c.reply(quotaMsg)
 }
 
 func newMessage(s DiscordSession, m *discordgo.MessageCreate) {
@@ -295,187 +612,375 @@ func newMessage(s DiscordSession, m *discordgo.MessageCreate) {
 		return
 	}
 
-	// Split the message content into words
-	args := strings.Fields(m.Content)
+	// Split the message content into arguments, keeping quoted text together
+	args, err := splitArgs(m.Content)
+	if err != nil {
+		if strings.HasPrefix(m.Content, "!") {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Could not read command: %v", err))
+		}
+		return
+	}
 	if len(args) == 0 {
 		return
 	}
 
-	// Check for admin commands first
-	if strings.HasPrefix(args[0], "!admin-") || args[0] == "!addadmin" || args[0] == "!removeadmin" || args[0] == "!register-user" || args[0] == "!remove-user" || args[0] == "!list-users" {
-		handleAdminCommands(s, m, args)
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
 		return
 	}
+	dispatch(newMessageCommandContext(s, m, args), cmd, false)
+}
 
-	// Handle regular commands
-	switch args[0] {
-	case "!register":
-		if len(args) != 3 {
-			s.ChannelMessageSend(m.ChannelID, "Usage: !register <character_name> <server>")
-			return
-		}
-		characterName := args[1]
-		server := args[2]
+func handleRegister(c *commandContext) {
+	s, ctx := c.session, c.ctx
+	characterName, server := c.params["character"], c.params["realm"]
 
-		// First, check if the character exists
-		exists, err := blizzardAPI.CharacterExists(characterName, server)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error verifying character: %v", err))
-			return
-		}
+	// First, check if the character exists
+	exists, err := blizzardAPI.CharacterExists(ctx, characterName, server)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error verifying character: %s", describeBlizzardError(err)))
+		return
+	}
 
-		if !exists {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", characterName, server))
-			return
-		}
+	if !exists {
+		c.reply(fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", characterName, server))
+		return
+	}
 
-		// Check if character is in Stand and Deliver
-		isInGuild, err := blizzardAPI.IsCharacterInGuild(characterName, server, 70395110) // Stand and Deliver guild ID
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error checking guild membership: %v", err))
-			return
-		}
+	// Check which of the tracked guilds the character is in
+	guild, _, err := trackedGuildOf(ctx, characterName, server)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error checking guild membership: %s", describeBlizzardError(err)))
+		return
+	}
 
-		// Create registration
-		reg := database.CharacterRegistration{
-			DiscordUsername: m.Author.Username,
-			CharacterName:   characterName,
-			Server:          server,
-		}
+	// Create registration
+	reg := database.CharacterRegistration{
+		DiscordUsername: c.user.Username,
+		DiscordUserID:   c.user.ID,
+		CharacterName:   characterName,
+		Server:          server,
+	}
 
-		// Register character
-		err = database.RegisterCharacter(db, reg)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Failed to register character: %v", err))
-			return
-		}
+	// Register character
+	err = database.RegisterCharacter(db, reg)
+	if err != nil {
+		c.reply(fmt.Sprintf("Failed to register character: %v", err))
+		return
+	}
+
+	// Get the Discord guild (server) ID from the message
+	channel, err := s.Channel(c.channelID)
+	if err != nil {
+		util.Logger.Printf("Error getting channel info: %v", err)
+		return
+	}
 
-		// Get the Discord guild (server) ID from the message
-		channel, err := s.Channel(m.ChannelID)
+	// Only process role updates if this is in a guild channel
+	if channel.GuildID != "" {
+		// Get member information
+		member, err := s.GuildMember(channel.GuildID, c.user.ID)
 		if err != nil {
-			util.Logger.Printf("Error getting channel info: %v", err)
-			return
-		}
+			util.Logger.Printf("Error getting member info: %v", err)
+		} else {
+			rank := -1
+			if guild != nil {
+				rank = guildRank(ctx, characterName, server)
+			}
+			facts, err := loadRuleFacts(ctx, characterName, server, guild != nil, rank)
+			if err != nil {
+				util.Logger.Printf("Error loading character data for role rules: %v", err)
+			}
 
-		// Only process role updates if this is in a guild channel
-		if channel.GuildID != "" {
-			// Get member information
-			member, err := s.GuildMember(channel.GuildID, m.Author.ID)
+			// Update roles
+			roleUpdateMsg, err := updateMemberRoles(s, channel.GuildID, member, exists, guild, rank, facts)
 			if err != nil {
-				util.Logger.Printf("Error getting member info: %v", err)
-			} else {
-				// Update roles
-				roleUpdateMsg, err := updateMemberRoles(s, channel.GuildID, member, exists, isInGuild)
-				if err != nil {
-					util.Logger.Printf("Error updating roles: %v", err)
-					s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Character registered successfully, but there was an error updating roles: %v", err))
-					return
-				}
-
-				// Send the test-compatible message first
-				successMsg := fmt.Sprintf("Successfully registered character %s on server %s", characterName, server)
-				if isInGuild {
-					successMsg += " (Stand and Deliver member)"
-				}
-				s.ChannelMessageSend(m.ChannelID, successMsg)
-
-				// Then send the detailed role update message
-				if roleUpdateMsg != "" {
-					s.ChannelMessageSend(m.ChannelID, roleUpdateMsg)
-				}
+				util.Logger.Printf("Error updating roles: %v", err)
+				c.reply(fmt.Sprintf("Character registered successfully, but there was an error updating roles: %v", err))
+				return
 			}
-		} else {
-			// For non-guild channels, just send the basic registration message
+
+			nickname, err := syncNickname(s, channel.GuildID, member, characterName, server)
+			switch {
+			case errors.Is(err, errNicknameNotPermitted):
+				roleUpdateMsg += "\nYour nickname was not changed because the bot lacks permission (as for the server owner)"
+			case err != nil:
+				util.Logger.Printf("Error setting nickname: %v", err)
+			case nickname != "":
+				roleUpdateMsg += fmt.Sprintf("\nNickname set to %s", nickname)
+			}
+
+			// Send the test-compatible message first
 			successMsg := fmt.Sprintf("Successfully registered character %s on server %s", characterName, server)
-			if isInGuild {
-				successMsg += " (Stand and Deliver member)"
+			if guild != nil {
+				successMsg += fmt.Sprintf(" (%s member)", guild.Name)
 			}
-			s.ChannelMessageSend(m.ChannelID, successMsg)
-		}
+			c.reply(successMsg)
 
-	case "!whoami":
-		reg, err := database.GetCharacter(db, m.Author.Username)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
-			return
+			// Then send the detailed role update message
+			if roleUpdateMsg != "" {
+				c.reply(roleUpdateMsg)
+			}
 		}
-		if reg == nil {
-			s.ChannelMessageSend(m.ChannelID, "You haven't registered a character yet. Use !register <character_name> <server> to register.")
-			return
+	} else {
+		// For non-guild channels, just send the basic registration message
+		successMsg := fmt.Sprintf("Successfully registered character %s on server %s", characterName, server)
+		if guild != nil {
+			successMsg += fmt.Sprintf(" (%s member)", guild.Name)
 		}
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Your registered character is %s on server %s", reg.CharacterName, reg.Server))
+		c.reply(successMsg)
+	}
+}
 
-	case "!guild":
-		reg, err := database.GetCharacter(db, m.Author.Username)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error: %v", err))
-			return
+func handleWhoami(c *commandContext) {
+	reg, err := database.GetCharacter(db, c.user.Username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply("You haven't registered a character yet. Use !register <character_name> <server> to register.")
+		return
+	}
+	card := loadCharacterCard(c.ctx, reg.CharacterName, reg.Server)
+	c.replyEmbed(whoamiEmbed(card), fmt.Sprintf("Your registered character is %s on server %s", reg.CharacterName, reg.Server))
+}
+
+func handleGuild(c *commandContext) {
+	ctx := c.ctx
+	reg, err := database.GetCharacter(db, c.user.Username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply("You haven't registered a character yet. Use !register <character_name> <server> to register.")
+		return
+	}
+
+	guildInfo, err := blizzardAPI.GetGuildInfo(ctx, reg.CharacterName, reg.Server)
+	if err != nil {
+		if errors.Is(err, blizzard.ErrGuildNotFound) || errors.Is(err, blizzard.ErrCharacterNotFound) {
+			c.reply(fmt.Sprintf("Could not find guild information. Please verify:\n1. The character %s exists on realm %s\n2. The character is in a guild\n3. The realm name is spelled correctly", reg.CharacterName, reg.Server))
+		} else {
+			c.reply(fmt.Sprintf("Failed to get guild info: %s", describeBlizzardError(err)))
 		}
-		if reg == nil {
-			s.ChannelMessageSend(m.ChannelID, "You haven't registered a character yet. Use !register <character_name> <server> to register.")
-			return
+		return
+	}
+
+	if guildInfo == nil {
+		c.reply("Character is not in a guild")
+		return
+	}
+
+	rankStr := "Unknown"
+	if guildInfo.Rank >= 0 {
+		rankStr = fmt.Sprintf("%d", guildInfo.Rank)
+	}
+
+	card := loadCharacterCard(ctx, reg.CharacterName, reg.Server)
+	c.replyEmbed(guildEmbed(card, guildInfo, rankStr), fmt.Sprintf("Guild: %s\nFaction: %s\nRank: %s", guildInfo.Name, guildInfo.Faction, rankStr))
+}
+
+func handlePing(c *commandContext) {
+	c.reply("Pong🏓")
+}
+
+func handleBye(c *commandContext) {
+	c.reply("Good Bye👋")
+}
+
+func handleMythicPlus(c *commandContext) {
+	ctx := c.ctx
+	characterName, realm, ok := characterOrRegistered(c)
+	if !ok {
+		return
+	}
+
+	profile, err := blizzardAPI.GetMythicKeystoneProfile(ctx, characterName, realm)
+	if err != nil {
+		if errors.Is(err, blizzard.ErrCharacterNotFound) {
+			c.reply(fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", characterName, realm))
+		} else {
+			c.reply(fmt.Sprintf("Failed to get Mythic+ profile: %s", describeBlizzardError(err)))
 		}
+		return
+	}
+	c.reply(formatMythicKeystoneProfile(profile))
+}
 
-		guildInfo, err := blizzardAPI.GetGuildInfo(reg.CharacterName, reg.Server)
-		if err != nil {
-			if strings.Contains(err.Error(), "guild not found") {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Could not find guild information. Please verify:\n1. The character %s exists on realm %s\n2. The character is in a guild\n3. The realm name is spelled correctly", reg.CharacterName, reg.Server))
-			} else {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Failed to get guild info: %v", err))
-			}
-			return
+func handleProgress(c *commandContext) {
+	ctx := c.ctx
+	characterName, realm, ok := characterOrRegistered(c)
+	if !ok {
+		return
+	}
+
+	encounters, err := blizzardAPI.GetRaidEncounters(ctx, characterName, realm)
+	if err != nil {
+		if errors.Is(err, blizzard.ErrCharacterNotFound) {
+			c.reply(fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", characterName, realm))
+		} else {
+			c.reply(fmt.Sprintf("Failed to get raid progression: %s", describeBlizzardError(err)))
 		}
+		return
+	}
+	tier, err := blizzardAPI.GetCurrentRaidTier(ctx)
+	if err != nil {
+		c.reply(fmt.Sprintf("Failed to get the current raid tier: %s", describeBlizzardError(err)))
+		return
+	}
+	c.reply(formatRaidProgress(encounters, tier))
+}
+
+func handleGear(c *commandContext) {
+	ctx := c.ctx
+	characterName, realm, ok := characterOrRegistered(c)
+	if !ok {
+		return
+	}
 
-		if guildInfo == nil {
-			s.ChannelMessageSend(m.ChannelID, "Character is not in a guild")
+	summary, err := blizzardAPI.GetCharacterSummary(ctx, characterName, realm)
+	if err == nil {
+		var equipment *blizzard.CharacterEquipment
+		equipment, err = blizzardAPI.GetCharacterEquipment(ctx, characterName, realm)
+		if err == nil {
+			c.reply(formatEquipment(summary, equipment))
 			return
 		}
+	}
+	if errors.Is(err, blizzard.ErrCharacterNotFound) {
+		c.reply(fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", characterName, realm))
+	} else {
+		c.reply(fmt.Sprintf("Failed to get equipment: %s", describeBlizzardError(err)))
+	}
+}
 
-		rankStr := "Unknown"
-		if guildInfo.Rank >= 0 {
-			rankStr = fmt.Sprintf("%d", guildInfo.Rank)
+func handleCheckGuild(c *commandContext) {
+	ctx := c.ctx
+	character, realm := c.params["character"], c.params["realm"]
+
+	guild, _, err := trackedGuildOf(ctx, character, realm)
+	if err != nil {
+		if errors.Is(err, blizzard.ErrCharacterNotFound) {
+			c.reply(fmt.Sprintf("Character %s was not found on realm %s. Please check the spelling and try again.", character, realm))
+			return
 		}
+		c.reply(fmt.Sprintf("Error checking guild membership: %s", describeBlizzardError(err)))
+		return
+	}
 
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Guild: %s\nFaction: %s\nRank: %s", guildInfo.Name, guildInfo.Faction, rankStr))
+	var result string
+	switch {
+	case guild != nil:
+		result = fmt.Sprintf("%s-%s is in %s", character, realm, guild.Name)
+	case len(cfg.Guilds()) == 1:
+		result = fmt.Sprintf("%s-%s is not in %s", character, realm, cfg.Guilds()[0].Name)
+	default:
+		result = fmt.Sprintf("%s-%s is not in any of our guilds (%s)", character, realm, trackedGuildNames())
+	}
+	card := loadCharacterCard(ctx, character, realm)
+	c.replyEmbed(checkGuildEmbed(card, result), result)
+}
 
-	case "!help":
-		helpMessage := `Available commands:
-!help - Show this help message
-!register <character_name> <server> - Register your character
-!whoami - Show your registered character
-!guild - Show your guild information
-!ping - Pong
-!bye - Say goodbye
-!checkguild <character> <realm> - Check if a character is in Stand and Deliver`
-		s.ChannelMessageSend(m.ChannelID, helpMessage)
+// characterOrRegistered returns the character given to the command, falling back to
+// the caller's registered character. It replies with an explanation and returns false
+// if no character could be determined.
+func characterOrRegistered(c *commandContext) (string, string, bool) {
+	if characterName, ok := c.params["character"]; ok {
+		return characterName, c.params["realm"], true
+	}
 
-	case "!ping":
-		s.ChannelMessageSend(m.ChannelID, "Pong🏓")
+	reg, err := database.GetCharacter(db, c.user.Username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return "", "", false
+	}
+	if reg == nil {
+		c.reply("You haven't registered a character yet. Use !register <character_name> <server> to register, or name a character and realm.")
+		return "", "", false
+	}
+	return reg.CharacterName, reg.Server, true
+}
 
-	case "!bye":
-		s.ChannelMessageSend(m.ChannelID, "Good Bye👋")
+// formatMythicKeystoneProfile renders a Mythic+ profile as a chat message
+func formatMythicKeystoneProfile(profile *blizzard.MythicKeystoneProfile) string {
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("Mythic+ profile for %s-%s", profile.CharacterName, profile.Realm))
+	if profile.SeasonID > 0 {
+		response.WriteString(fmt.Sprintf(" (season %d)", profile.SeasonID))
+	}
+	response.WriteString(fmt.Sprintf("\nRating: %.1f", profile.CurrentRating))
 
-	case "!checkguild":
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Usage: !checkguild <character> <realm>")
-			return
+	if len(profile.BestRuns) == 0 {
+		response.WriteString("\nNo keystones completed this season")
+		return response.String()
+	}
+
+	response.WriteString("\nBest runs:")
+	for _, run := range profile.BestRuns {
+		timed := "timed"
+		if !run.IsCompletedWithinTime {
+			timed = "over time"
 		}
-		character := args[1]
-		realm := args[2]
+		duration := run.DurationTime().Round(time.Second)
+		response.WriteString(fmt.Sprintf("\n- %s +%d (%s, %d:%02d, %.1f rating)",
+			run.Dungeon.Name, run.KeystoneLevel, timed, int(duration.Minutes()), int(duration.Seconds())%60, run.MythicRating.Rating))
+	}
+	return response.String()
+}
 
-		// Stand and Deliver guild ID on Cenarius
-		guildID := 70395110
+// formatRaidProgress renders the current raid tier's bosses killed per difficulty
+func formatRaidProgress(encounters *blizzard.RaidEncounters, tier *blizzard.RaidTier) string {
+	name := fmt.Sprintf("%s-%s", encounters.Character.Name, encounters.Character.Realm.Name)
 
-		isInGuild, err := blizzardAPI.IsCharacterInGuild(character, realm, guildID)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error checking guild membership: %v", err))
-			return
-		}
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("Raid progression for %s\n%s (%s)", name, tier.InstanceName, tier.ExpansionName))
+	var modes []blizzard.RaidModeProgress
+	if instance := encounters.InstanceProgress(tier.InstanceID); instance != nil {
+		modes = instance.ModesByDifficulty()
+	}
+	if len(modes) == 0 {
+		response.WriteString(fmt.Sprintf("\nNo bosses killed yet: 0/%d", tier.EncounterCount))
+		return response.String()
+	}
+	for _, mode := range modes {
+		response.WriteString(fmt.Sprintf("\n%s: %d/%d", mode.Difficulty.Name, mode.Progress.CompletedCount, mode.Progress.TotalCount))
+	}
+	return response.String()
+}
 
-		if isInGuild {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s-%s is in Stand and Deliver", character, realm))
-		} else {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s-%s is not in Stand and Deliver", character, realm))
+// formatEquipment renders item levels per slot, missing enchants and empty sockets
+func formatEquipment(summary *blizzard.CharacterSummary, equipment *blizzard.CharacterEquipment) string {
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("Gear for %s-%s\nItem level: %d equipped (%d average)",
+		summary.Name, summary.Realm.Name, summary.EquippedItemLevel, summary.AverageItemLevel))
+
+	var emptySockets []string
+	for _, item := range equipment.EquippedItems {
+		if item.IsCosmetic() {
+			continue
 		}
+		response.WriteString(fmt.Sprintf("\n%s: %d %s", item.Slot.Name, item.Level.Value, item.Name))
+		if empty := item.EmptySockets(); empty > 0 {
+			emptySockets = append(emptySockets, fmt.Sprintf("%s (%d)", item.Slot.Name, empty))
+		}
+	}
+
+	var missingEnchants []string
+	for _, item := range equipment.MissingEnchants() {
+		missingEnchants = append(missingEnchants, item.Slot.Name)
+	}
+
+	if len(missingEnchants) > 0 {
+		response.WriteString(fmt.Sprintf("\nMissing enchants: %s", strings.Join(missingEnchants, ", ")))
+	} else {
+		response.WriteString("\nMissing enchants: none")
+	}
+	if len(emptySockets) > 0 {
+		response.WriteString(fmt.Sprintf("\nEmpty sockets: %s", strings.Join(emptySockets, ", ")))
+	} else {
+		response.WriteString("\nEmpty sockets: none")
 	}
+	return response.String()
 }
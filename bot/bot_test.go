@@ -1,12 +1,16 @@
 package bot
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bezerker/sndbot/blizzard"
 	config "github.com/bezerker/sndbot/config"
@@ -27,6 +31,17 @@ type TestSession struct {
 	state       *discordgo.State
 	roles       map[string][]string // userID -> roleIDs
 	guildID     string
+	// interaction responses and registered slash commands
+	responses []*discordgo.InteractionResponse
+	commands  []*discordgo.ApplicationCommand
+	// embeds fail unless allowed, like a channel without the Embed Links permission
+	embedsAllowed bool
+	embeds        map[string][]*discordgo.MessageEmbed // channelID -> embeds
+	// messages sent with components or files
+	complex []*discordgo.MessageSend
+	// usernames of server members found by GuildMembersSearch, mapped to user IDs
+	usernames map[string]string
+	nicknames map[string]string // userID -> nickname
 }
 
 func NewTestSession() *TestSession {
@@ -41,6 +56,7 @@ func NewTestSession() *TestSession {
 		state:       state,
 		roles:       make(map[string][]string),
 		guildID:     "test-guild",
+		embeds:      make(map[string][]*discordgo.MessageEmbed),
 	}
 }
 
@@ -55,6 +71,21 @@ func (ts *TestSession) ChannelMessageSend(channelID string, content string, opti
 	}, nil
 }
 
+func (ts *TestSession) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if !ts.embedsAllowed {
+		return nil, fmt.Errorf("HTTP 403 Forbidden, Missing Permissions")
+	}
+	ts.embeds[channelID] = append(ts.embeds[channelID], embed)
+	return &discordgo.Message{ChannelID: channelID, Embeds: []*discordgo.MessageEmbed{embed}}, nil
+}
+
+// ChannelMessageSendComplex records the content and attachments of the message
+func (ts *TestSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	ts.messages[channelID] = append(ts.messages[channelID], data.Content)
+	ts.complex = append(ts.complex, data)
+	return &discordgo.Message{Content: data.Content, ChannelID: channelID}, nil
+}
+
 func (ts *TestSession) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
 	channel := &discordgo.Channel{
 		ID:   channelID,
@@ -89,9 +120,41 @@ func (ts *TestSession) GuildMember(guildID, userID string) (*discordgo.Member, e
 			Username: "testuser",
 		},
 		Roles: roles,
+		Nick:  ts.nicknames[userID],
 	}, nil
 }
 
+// GuildMembersSearch returns the members whose username starts with the query
+func (ts *TestSession) GuildMembersSearch(guildID, query string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error) {
+	var members []*discordgo.Member
+	for username, userID := range ts.usernames {
+		if strings.HasPrefix(username, query) {
+			members = append(members, &discordgo.Member{User: &discordgo.User{ID: userID, Username: username}, Roles: ts.roles[userID]})
+		}
+	}
+	return members, nil
+}
+
+// GuildMemberNickname records the nickname; the server owner cannot be renamed
+func (ts *TestSession) GuildMemberNickname(guildID, userID, nickname string, options ...discordgo.RequestOption) error {
+	if userID == "owner-id" {
+		return &discordgo.RESTError{
+			Response: &http.Response{StatusCode: http.StatusForbidden},
+			Message:  &discordgo.APIErrorMessage{Code: discordgo.ErrCodeMissingPermissions, Message: "Missing Permissions"},
+		}
+	}
+	if ts.nicknames == nil {
+		ts.nicknames = make(map[string]string)
+	}
+	ts.nicknames[userID] = nickname
+	return nil
+}
+
+// UserChannelCreate returns a DM channel whose messages are recorded under "dm-<userID>"
+func (ts *TestSession) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
 func (ts *TestSession) GuildMemberRoleAdd(guildID, userID, roleID string) error {
 	if ts.roles[userID] == nil {
 		ts.roles[userID] = make([]string, 0)
@@ -106,10 +169,69 @@ func (ts *TestSession) GuildMemberRoleAdd(guildID, userID, roleID string) error
 	return nil
 }
 
+func (ts *TestSession) GuildMemberRoleRemove(guildID, userID, roleID string) error {
+	roles := ts.roles[userID][:0]
+	for _, role := range ts.roles[userID] {
+		if role != roleID {
+			roles = append(roles, role)
+		}
+	}
+	ts.roles[userID] = roles
+	return nil
+}
+
+// InteractionRespond records the response; message responses are also recorded as channel messages
+func (ts *TestSession) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	ts.responses = append(ts.responses, resp)
+	if resp.Type == discordgo.InteractionResponseChannelMessageWithSource {
+		ts.messages[interaction.ChannelID] = append(ts.messages[interaction.ChannelID], resp.Data.Content)
+	}
+	return nil
+}
+
+// FollowupMessageCreate records follow-up messages as channel messages and embeds
+func (ts *TestSession) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if data.Content != "" {
+		ts.messages[interaction.ChannelID] = append(ts.messages[interaction.ChannelID], data.Content)
+	}
+	ts.embeds[interaction.ChannelID] = append(ts.embeds[interaction.ChannelID], data.Embeds...)
+	return &discordgo.Message{Content: data.Content, ChannelID: interaction.ChannelID}, nil
+}
+
+func (ts *TestSession) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	ts.commands = commands
+	return commands, nil
+}
+
 func (ts *TestSession) GetUserRoles(userID string) []string {
 	return ts.roles[userID]
 }
 
+// createTestInteraction builds a slash command invocation from a guild member
+func createTestInteraction(name, username, channelID string, options map[string]string) *discordgo.InteractionCreate {
+	data := discordgo.ApplicationCommandInteractionData{Name: name}
+	for optionName, value := range options {
+		data.Options = append(data.Options, &discordgo.ApplicationCommandInteractionDataOption{
+			Name:  optionName,
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: value,
+		})
+	}
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:      discordgo.InteractionApplicationCommand,
+			ChannelID: channelID,
+			Data:      data,
+			Member: &discordgo.Member{
+				User: &discordgo.User{
+					Username: username,
+					ID:       "test-user-id",
+				},
+			},
+		},
+	}
+}
+
 // Test helper functions
 func setupTestDB(t *testing.T) *sql.DB {
 	db, err := database.InitDB(":memory:") // Use SQLite in-memory database
@@ -256,6 +378,14 @@ func TestAdminCommands(t *testing.T) {
 			isDM:          true,
 			shouldRespond: true,
 		},
+		{
+			name:          "Admin api quota",
+			user:          adminUser,
+			command:       "!api-quota",
+			wantMsg:       "Quota usage is not available",
+			isDM:          true,
+			shouldRespond: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -270,7 +400,7 @@ func TestAdminCommands(t *testing.T) {
 			}
 
 			msg := createTestMessage(tt.command, tt.user, channelID)
-			handleAdminCommands(ts, msg, strings.Fields(tt.command))
+			newMessage(ts, msg)
 
 			messages := ts.GetMessages(channelID)
 			if tt.shouldRespond {
@@ -397,6 +527,13 @@ func TestSimpleCommands(t *testing.T) {
 type MockBlizzardAPI struct {
 	existingCharacters map[string]bool
 	guildMembers       map[string]bool
+	// characterGuilds overrides the guild of members that are not in Stand and Deliver
+	characterGuilds map[string]*blizzard.Guild
+	// guildRanks overrides the rank of guild members, which is 3 otherwise
+	guildRanks map[string]int
+	// mythicRatings overrides the current season rating of characters, which is 2450.5 otherwise
+	mythicRatings map[string]float64
+	currentTier   *blizzard.RaidTier
 }
 
 var currentMock *MockBlizzardAPI
@@ -405,6 +542,15 @@ func NewMockBlizzardAPI() BlizzardAPI {
 	mock := &MockBlizzardAPI{
 		existingCharacters: make(map[string]bool),
 		guildMembers:       make(map[string]bool),
+		characterGuilds:    make(map[string]*blizzard.Guild),
+		guildRanks:         make(map[string]int),
+		mythicRatings:      make(map[string]float64),
+		currentTier: &blizzard.RaidTier{
+			ExpansionName:  "The War Within",
+			InstanceName:   "Liberation of Undermine",
+			InstanceID:     1296,
+			EncounterCount: 8,
+		},
 	}
 	currentMock = mock
 	blizzardAPI = mock
@@ -412,7 +558,10 @@ func NewMockBlizzardAPI() BlizzardAPI {
 }
 
 // CharacterExists mocks the character existence check
-func (m *MockBlizzardAPI) CharacterExists(characterName, realm string) (bool, error) {
+func (m *MockBlizzardAPI) CharacterExists(ctx context.Context, characterName, realm string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
 	exists := m.existingCharacters[key]
 	if util.IsDebugEnabled() {
@@ -421,22 +570,18 @@ func (m *MockBlizzardAPI) CharacterExists(characterName, realm string) (bool, er
 	return exists, nil
 }
 
-// IsCharacterInGuild mocks the guild membership check
-func (m *MockBlizzardAPI) IsCharacterInGuild(characterName, realm string, guildID int) (bool, error) {
-	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
-	inGuild := m.guildMembers[key]
-	if util.IsDebugEnabled() {
-		util.Logger.Printf("[MOCK] Guild membership check for %s (guild ID %d): %v", key, guildID, inGuild)
-	}
-	return inGuild, nil
-}
-
 // GetCharacterGuild mocks getting a character's guild information
-func (m *MockBlizzardAPI) GetCharacterGuild(characterName, realm string) (*blizzard.Guild, error) {
+func (m *MockBlizzardAPI) GetCharacterGuild(ctx context.Context, characterName, realm string) (*blizzard.Guild, error) {
 	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
 	if !m.guildMembers[key] {
 		return nil, nil
 	}
+	if guild, ok := m.characterGuilds[key]; ok {
+		return guild, nil
+	}
 	return &blizzard.Guild{
 		Name: "Stand and Deliver",
 		ID:   70395110,
@@ -449,31 +594,149 @@ func (m *MockBlizzardAPI) GetCharacterGuild(characterName, realm string) (*blizz
 }
 
 // GetGuildInfo mocks getting guild information
-func (m *MockBlizzardAPI) GetGuildInfo(characterName, realm string) (*blizzard.GuildInfo, error) {
+func (m *MockBlizzardAPI) GetGuildInfo(ctx context.Context, characterName, realm string) (*blizzard.GuildInfo, error) {
 	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
 	if !m.guildMembers[key] {
 		return nil, nil
 	}
+	rank, ok := m.guildRanks[key]
+	if !ok {
+		rank = 3
+	}
 	return &blizzard.GuildInfo{
 		Name:    "Stand and Deliver",
-		Rank:    3,
+		Rank:    rank,
 		Faction: "Alliance",
 	}, nil
 }
 
-// GetGuildMemberInfo mocks getting guild member information
-func (m *MockBlizzardAPI) GetGuildMemberInfo(characterName, realmSlug, guildName string) (*blizzard.GuildMember, error) {
-	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realmSlug))
-	if !m.guildMembers[key] {
-		return nil, nil
+// GetGuildRoster mocks getting the full guild roster from the mock's guild members
+func (m *MockBlizzardAPI) GetGuildRoster(ctx context.Context, realmSlug, guildSlug string) (*blizzard.GuildRoster, error) {
+	roster := &blizzard.GuildRoster{
+		Guild: blizzard.Guild{Name: "Stand and Deliver", ID: 70395110},
+	}
+	for key := range m.guildMembers {
+		parts := strings.SplitN(key, "-", 2)
+		member := blizzard.RosterMember{Rank: 3}
+		member.Character.Name = parts[0]
+		member.Character.Realm.Slug = parts[1]
+		member.Character.Level = 80
+		roster.Members = append(roster.Members, member)
+	}
+	return roster, nil
+}
+
+// GetMythicKeystoneProfile mocks getting a character's Mythic+ profile
+func (m *MockBlizzardAPI) GetMythicKeystoneProfile(ctx context.Context, characterName, realm string) (*blizzard.MythicKeystoneProfile, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
 	}
-	member := &blizzard.GuildMember{}
-	member.Character.Name = characterName
-	member.Character.Realm.Name = realmSlug
-	member.Character.Realm.ID = 1
-	member.Character.Realm.Slug = strings.ToLower(strings.ReplaceAll(realmSlug, " ", "-"))
-	member.Rank = 3
-	return member, nil
+	run := blizzard.MythicKeystoneRun{
+		KeystoneLevel:         12,
+		Duration:              1725000,
+		IsCompletedWithinTime: true,
+		MythicRating:          blizzard.MythicRating{Rating: 280},
+	}
+	run.Dungeon.Name = "The Stonevault"
+	rating, ok := m.mythicRatings[key]
+	if !ok {
+		rating = 2450.5
+	}
+	return &blizzard.MythicKeystoneProfile{
+		CharacterName: characterName,
+		Realm:         realm,
+		CurrentRating: rating,
+		SeasonID:      13,
+		BestRuns:      []blizzard.MythicKeystoneRun{run},
+	}, nil
+}
+
+// GetRaidEncounters mocks getting a character's raid progression
+func (m *MockBlizzardAPI) GetRaidEncounters(ctx context.Context, characterName, realm string) (*blizzard.RaidEncounters, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
+	var mode blizzard.RaidModeProgress
+	mode.Difficulty.Type = "HEROIC"
+	mode.Difficulty.Name = "Heroic"
+	mode.Progress.CompletedCount = 5
+	mode.Progress.TotalCount = 8
+	var instance blizzard.RaidInstanceProgress
+	instance.Instance.Name = "Liberation of Undermine"
+	instance.Instance.ID = 1296
+	instance.Modes = []blizzard.RaidModeProgress{mode}
+	var expansion blizzard.RaidExpansionProgress
+	expansion.Expansion.Name = "The War Within"
+	expansion.Instances = []blizzard.RaidInstanceProgress{instance}
+	encounters := &blizzard.RaidEncounters{Expansions: []blizzard.RaidExpansionProgress{expansion}}
+	encounters.Character.Name = characterName
+	encounters.Character.Realm.Name = realm
+	return encounters, nil
+}
+
+// GetCurrentRaidTier mocks getting the current raid from the journal
+func (m *MockBlizzardAPI) GetCurrentRaidTier(ctx context.Context) (*blizzard.RaidTier, error) {
+	return m.currentTier, nil
+}
+
+// GetCharacterSummary mocks getting a character's profile summary
+func (m *MockBlizzardAPI) GetCharacterSummary(ctx context.Context, characterName, realm string) (*blizzard.CharacterSummary, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
+	return &blizzard.CharacterSummary{
+		Name:              characterName,
+		Realm:             blizzard.Realm{Name: realm, Slug: strings.ToLower(realm)},
+		Level:             80,
+		CharacterClass:    blizzard.PlayableClass{ID: 8, Name: "Mage"},
+		AverageItemLevel:  624,
+		EquippedItemLevel: 621,
+	}, nil
+}
+
+// GetCharacterAchievements mocks getting a character's achievements; every character has
+// completed achievement 40253
+func (m *MockBlizzardAPI) GetCharacterAchievements(ctx context.Context, characterName, realm string) (*blizzard.CharacterAchievements, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
+	achievement := blizzard.CharacterAchievement{ID: 40253, CompletedTimestamp: 1727740800000}
+	achievement.Achievement.ID = 40253
+	return &blizzard.CharacterAchievements{Achievements: []blizzard.CharacterAchievement{achievement}}, nil
+}
+
+// GetCharacterMedia mocks getting a character's renders
+func (m *MockBlizzardAPI) GetCharacterMedia(ctx context.Context, characterName, realm string) (*blizzard.CharacterMedia, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
+	return &blizzard.CharacterMedia{Assets: []blizzard.MediaAsset{{Key: blizzard.MediaAvatar, Value: "https://render.example/" + key + ".jpg"}}}, nil
+}
+
+// GetCharacterEquipment mocks getting a character's equipment
+func (m *MockBlizzardAPI) GetCharacterEquipment(ctx context.Context, characterName, realm string) (*blizzard.CharacterEquipment, error) {
+	key := fmt.Sprintf("%s-%s", strings.ToLower(characterName), strings.ToLower(realm))
+	if !m.existingCharacters[key] {
+		return nil, blizzard.ErrCharacterNotFound
+	}
+	var back, shirt blizzard.EquippedItem
+	back.Slot.Type = "BACK"
+	back.Slot.Name = "Back"
+	back.Name = "Cloak"
+	back.Level.Value = 619
+	back.Sockets = []blizzard.ItemSocket{{}}
+	shirt.Slot.Type = "SHIRT"
+	shirt.Slot.Name = "Shirt"
+	shirt.Level.Value = 1
+	return &blizzard.CharacterEquipment{EquippedItems: []blizzard.EquippedItem{back, shirt}}, nil
 }
 
 func addMockCharacter(name, realm string, inGuild bool) {
@@ -566,3 +829,1291 @@ func TestRegisterNonGuildCharacter(t *testing.T) {
 		t.Errorf("Expected community role, got %s", roles[0])
 	}
 }
+
+// Test that shutdown waits for in-flight handlers and refuses to start new ones
+func TestWaitForHandlers(t *testing.T) {
+	defer func() { shuttingDown = false }()
+
+	if !startHandler() {
+		t.Fatal("Expected a handler to start before shutdown")
+	}
+	finished := false
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+		handlers.Done()
+	}()
+
+	waitForHandlers(time.Second)
+	if !finished {
+		t.Error("Expected shutdown to wait for the in-flight handler")
+	}
+	if startHandler() {
+		handlers.Done()
+		t.Error("Expected no handler to start once shutdown has begun")
+	}
+}
+
+// Test that commands are aborted once the bot is shutting down
+func TestRegisterDuringShutdown(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "testrealm", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	botCtx = ctx
+	defer func() { botCtx = context.Background() }()
+
+	msg := createTestMessage("!register testchar testrealm", "testuser", "channel1")
+	newMessage(ts, msg)
+
+	messages := ts.GetMessages("channel1")
+	if len(messages) != 1 || !strings.Contains(messages[0], "shutting down") {
+		t.Errorf("Expected shutdown message, got %v", messages)
+	}
+
+	reg, err := database.GetCharacter(db, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to get character: %v", err)
+	}
+	if reg != nil {
+		t.Error("Expected no registration to be stored")
+	}
+}
+
+// Test that checking an unknown character gives a precise message
+func TestCheckGuildUnknownCharacter(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+
+	msg := createTestMessage("!checkguild nobody testrealm", "testuser", "channel1")
+	newMessage(ts, msg)
+
+	messages := ts.GetMessages("channel1")
+	expectedResponse := "Character nobody was not found on realm testrealm. Please check the spelling and try again."
+	if len(messages) != 1 || messages[0] != expectedResponse {
+		t.Errorf("Expected message '%s', got %v", expectedResponse, messages)
+	}
+}
+
+// Test that Blizzard API responses round-trip through the database cache store
+func TestDBCacheStore(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	store := dbCacheStore{db: testDB}
+	missing, err := store.LoadCacheEntry("missing")
+	if err != nil || missing != nil {
+		t.Fatalf("Expected no entry, got %+v (err=%v)", missing, err)
+	}
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	entry := blizzard.CacheEntry{
+		Key:          "https://us.api.blizzard.com/profile/wow/character/cenarius/testchar",
+		Body:         []byte(`{"name":"Testchar"}`),
+		LastModified: "Mon, 01 Jan 2024 00:00:00 GMT",
+		ExpiresAt:    expires,
+	}
+	if err := store.SaveCacheEntry(entry); err != nil {
+		t.Fatalf("Failed to save entry: %v", err)
+	}
+
+	loaded, err := store.LoadCacheEntry(entry.Key)
+	if err != nil || loaded == nil {
+		t.Fatalf("Expected entry, got %+v (err=%v)", loaded, err)
+	}
+	if string(loaded.Body) != string(entry.Body) || loaded.LastModified != entry.LastModified || !loaded.ExpiresAt.Equal(expires) {
+		t.Errorf("Entry did not round-trip: %+v", loaded)
+	}
+}
+
+// Test that !mplus falls back to the registered character
+func TestMythicPlusCommand(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "testrealm", true)
+
+	err := database.RegisterCharacter(db, database.CharacterRegistration{
+		DiscordUsername: "testuser",
+		CharacterName:   "testchar",
+		Server:          "testrealm",
+	})
+	if err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+
+	newMessage(ts, createTestMessage("!mplus", "testuser", "channel1"))
+	newMessage(ts, createTestMessage("!mplus nobody testrealm", "testuser", "channel2"))
+
+	messages := ts.GetMessages("channel1")
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	for _, part := range []string{"testchar-testrealm", "Rating: 2450.5", "The Stonevault +12 (timed, 28:45, 280.0 rating)"} {
+		if !strings.Contains(messages[0], part) {
+			t.Errorf("Expected message to contain '%s', got '%s'", part, messages[0])
+		}
+	}
+
+	messages = ts.GetMessages("channel2")
+	if len(messages) != 1 || !strings.Contains(messages[0], "was not found") {
+		t.Errorf("Expected not found message, got %v", messages)
+	}
+}
+
+// Test that !progress summarizes the current raid tier
+func TestProgressCommand(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("raider", "testrealm", false)
+
+	newMessage(ts, createTestMessage("!progress raider testrealm", "testuser", "channel1"))
+	newMessage(ts, createTestMessage("!progress", "testuser", "channel2"))
+
+	messages := ts.GetMessages("channel1")
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	for _, part := range []string{"raider-testrealm", "Liberation of Undermine (The War Within)", "Heroic: 5/8"} {
+		if !strings.Contains(messages[0], part) {
+			t.Errorf("Expected message to contain '%s', got '%s'", part, messages[0])
+		}
+	}
+
+	messages = ts.GetMessages("channel2")
+	if len(messages) != 1 || !strings.Contains(messages[0], "haven't registered") {
+		t.Errorf("Expected registration hint, got %v", messages)
+	}
+
+	// Progress in an older raid is not shown as the current tier
+	currentMock.currentTier = &blizzard.RaidTier{ExpansionName: "The War Within", InstanceName: "Manaforge Omega", InstanceID: 1302, EncounterCount: 8}
+	newMessage(ts, createTestMessage("!progress raider testrealm", "testuser", "channel3"))
+	messages = ts.GetMessages("channel3")
+	if len(messages) != 1 || !strings.HasSuffix(messages[0], "Manaforge Omega (The War Within)\nNo bosses killed yet: 0/8") {
+		t.Errorf("Expected no kills in the current raid, got %v", messages)
+	}
+}
+
+// Test that !gear reports item levels, missing enchants and empty sockets
+func TestGearCommand(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("geared", "testrealm", false)
+
+	newMessage(ts, createTestMessage("!gear geared testrealm", "testuser", "channel1"))
+
+	messages := ts.GetMessages("channel1")
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	for _, part := range []string{"Item level: 621 equipped (624 average)", "Back: 619 Cloak", "Missing enchants: Back", "Empty sockets: Back (1)"} {
+		if !strings.Contains(messages[0], part) {
+			t.Errorf("Expected message to contain '%s', got '%s'", part, messages[0])
+		}
+	}
+	if strings.Contains(messages[0], "Shirt") {
+		t.Errorf("Expected cosmetic slots to be skipped, got '%s'", messages[0])
+	}
+}
+
+// Test that unknown realms are reported with suggestions
+func TestDescribeRealmNotFound(t *testing.T) {
+	err := fmt.Errorf("failed to check character: %w", &blizzard.RealmNotFoundError{Input: "Mal Gannis", Suggestions: []string{"Mal'Ganis", "Malfurion"}})
+	expected := "realm Mal Gannis was not found, did you mean Mal'Ganis or Malfurion?"
+	if got := describeBlizzardError(err); got != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, got)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{content: "!register testchar testrealm", want: []string{"!register", "testchar", "testrealm"}},
+		{content: `!register testchar "Area 52"`, want: []string{"!register", "testchar", "Area 52"}},
+		{content: "!register testchar “Twisting Nether”", want: []string{"!register", "testchar", "Twisting Nether"}},
+		{content: "!register testchar Mal'Ganis", want: []string{"!register", "testchar", "Mal'Ganis"}},
+		{content: `!checkguild "Testchar-Aerie Peak"`, want: []string{"!checkguild", "Testchar-Aerie Peak"}},
+		{content: `!register testchar "Area 52`, wantErr: true},
+		{content: "   ", want: nil},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.content)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for '%s'", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %v", tt.content, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("Expected %q for '%s', got %q", tt.want, tt.content, got)
+		}
+	}
+}
+
+func TestParseCharacter(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantName  string
+		wantRealm string
+		wantOK    bool
+	}{
+		{args: []string{"testchar", "testrealm"}, wantName: "testchar", wantRealm: "testrealm", wantOK: true},
+		{args: []string{"testchar", "Twisting", "Nether"}, wantName: "testchar", wantRealm: "Twisting Nether", wantOK: true},
+		{args: []string{"Testchar-Area 52"}, wantName: "Testchar", wantRealm: "Area 52", wantOK: true},
+		{args: []string{"Testchar-Aerie", "Peak"}, wantName: "Testchar", wantRealm: "Aerie Peak", wantOK: true},
+		{args: []string{"https://worldofwarcraft.blizzard.com/en-us/character/us/area-52/testchar"}, wantName: "testchar", wantRealm: "area-52", wantOK: true},
+		{args: []string{"https://raider.io/characters/eu/kazzak/T%C3%A9stchar"}, wantName: "Téstchar", wantRealm: "kazzak", wantOK: true},
+		{args: []string{"https://worldofwarcraft.blizzard.com/en-us/character/us"}, wantOK: false},
+		{args: []string{"testchar"}, wantOK: false},
+		{args: []string{"testchar-"}, wantOK: false},
+		{args: nil, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		name, realm, ok := parseCharacter(tt.args)
+		if ok != tt.wantOK || name != tt.wantName || realm != tt.wantRealm {
+			t.Errorf("parseCharacter(%q) = (%s, %s, %v), expected (%s, %s, %v)", tt.args, name, realm, ok, tt.wantName, tt.wantRealm, tt.wantOK)
+		}
+	}
+}
+
+// Test that realms with spaces can be registered using quotes
+func TestRegisterQuotedRealm(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "Area 52", false)
+
+	newMessage(ts, createTestMessage(`!register testchar "Area 52"`, "testuser", "channel1"))
+
+	messages := ts.GetMessages("channel1")
+	if len(messages) == 0 || messages[0] != "Successfully registered character testchar on server Area 52" {
+		t.Errorf("Expected successful registration, got %v", messages)
+	}
+
+	reg, err := database.GetCharacter(db, "testuser")
+	if err != nil || reg == nil || reg.Server != "Area 52" {
+		t.Errorf("Expected registration on Area 52, got %+v (%v)", reg, err)
+	}
+}
+
+// Test that /register defers the response and replies with follow-up messages
+func TestSlashRegister(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "Area 52", true)
+
+	newInteraction(ts, createTestInteraction("register", "testuser", "channel1", map[string]string{
+		"realm":     "Area 52",
+		"character": "testchar",
+	}))
+
+	if len(ts.responses) != 1 || ts.responses[0].Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Fatalf("Expected a single deferred response, got %+v", ts.responses)
+	}
+	messages := ts.GetMessages("channel1")
+	expected := "Successfully registered character testchar on server Area 52 (Stand and Deliver member)"
+	if len(messages) == 0 || messages[0] != expected {
+		t.Errorf("Expected message '%s', got %v", expected, messages)
+	}
+}
+
+// Test that admin slash commands are hidden from members and take users as user options
+func TestSlashAdminCommands(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	for _, definition := range slashCommands() {
+		cmd := lookupCommand("!" + definition.Name)
+		hidden := definition.DefaultMemberPermissions != nil && *definition.DefaultMemberPermissions == 0
+		if hidden != (cmd.permission == permissionAdmin) {
+			t.Errorf("Expected /%s to be hidden only if it is an admin command", definition.Name)
+		}
+		if definition.DMPermission == nil || *definition.DMPermission != (cmd.scope != scopeGuild) {
+			t.Errorf("Unexpected DM permission for /%s", definition.Name)
+		}
+	}
+
+	ts := NewTestSession()
+	if err := database.AddAdmin(db, "testuser"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "target", CharacterName: "char", Server: "cenarius"})
+	if err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+
+	interaction := createTestInteraction("remove-user", "testuser", "dm", nil)
+	interaction.Member = nil
+	interaction.User = &discordgo.User{ID: "test-user-id", Username: "testuser"}
+	interaction.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "remove-user",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "discord_username", Type: discordgo.ApplicationCommandOptionUser, Value: "target-id"},
+		},
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Users: map[string]*discordgo.User{"target-id": {ID: "target-id", Username: "target"}},
+		},
+	}
+	newInteraction(ts, interaction)
+
+	if reg, _ := database.GetCharacter(db, "target"); reg != nil {
+		t.Errorf("Expected the selected user's registration to be removed, got %+v", reg)
+	}
+}
+
+// Test that fast slash commands respond immediately and admin commands stay private
+func TestSlashCommandResponses(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	newInteraction(ts, createTestInteraction("ping", "testuser", "channel1", nil))
+	if len(ts.responses) != 1 || ts.responses[0].Type != discordgo.InteractionResponseChannelMessageWithSource {
+		t.Fatalf("Expected an immediate message response, got %+v", ts.responses)
+	}
+	if ts.responses[0].Data.Content != "Pong🏓" {
+		t.Errorf("Expected 'Pong🏓', got '%s'", ts.responses[0].Data.Content)
+	}
+
+	ts = NewTestSession()
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+	// list-users is deferred since it may query the guild roster, so use api-quota
+	newInteraction(ts, createTestInteraction("api-quota", "testuser", "channel1", nil))
+	if len(ts.responses) != 1 || ts.responses[0].Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Fatalf("Expected an ephemeral response, got %+v", ts.responses)
+	}
+	if !strings.Contains(ts.responses[0].Data.Content, "only available in DMs") {
+		t.Errorf("Expected DM-only message, got '%s'", ts.responses[0].Data.Content)
+	}
+}
+
+func TestRegisterSlashCommands(t *testing.T) {
+	ts := NewTestSession()
+	if err := registerSlashCommands(ts, "app-id"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, command := range ts.commands {
+		names[command.Name] = true
+	}
+	for _, name := range []string{"register", "whoami", "guild", "checkguild", "admin-help", "list-users"} {
+		if !names[name] {
+			t.Errorf("Expected slash command '%s' to be registered", name)
+		}
+	}
+}
+
+// Test that usage errors and aliases come from the command registry
+func TestCommandRegistry(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	newMessage(ts, createTestMessage("!register testchar", "testuser", "channel1"))
+	newMessage(ts, createTestMessage("!whoami extra", "testuser", "channel1"))
+
+	messages := ts.GetMessages("channel1")
+	expected := []string{
+		"Usage: !register <character> <realm> (or Name-Realm, or a link to the character's armory page)",
+		"Usage: !whoami",
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i, want := range expected {
+		if messages[i] != want {
+			t.Errorf("Expected '%s', got '%s'", want, messages[i])
+		}
+	}
+
+	if cmd := lookupCommand("!M+"); cmd == nil || cmd.name != "mplus" {
+		t.Errorf("Expected !M+ to resolve to mplus, got %+v", cmd)
+	}
+	if cmd := lookupCommand("!unknown"); cmd != nil {
+		t.Errorf("Expected no command, got %+v", cmd)
+	}
+
+	// Every command shows up in exactly one help text
+	userHelp := helpText("", permissionEveryone)
+	adminHelp := helpText("", permissionAdmin)
+	for _, cmd := range commands {
+		inUser := strings.Contains(userHelp, "\n"+cmd.usage()+" - ")
+		inAdmin := strings.Contains(adminHelp, "\n"+cmd.usage()+" - ")
+		if inUser == inAdmin {
+			t.Errorf("Expected !%s in exactly one help text (user=%v admin=%v)", cmd.name, inUser, inAdmin)
+		}
+	}
+}
+
+// Test that character commands reply with embeds where the channel allows them
+func TestCharacterEmbeds(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	ts.embedsAllowed = true
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "testrealm", true)
+	if err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "testuser", CharacterName: "testchar", Server: "testrealm"}); err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+
+	newMessage(ts, createTestMessage("!whoami", "testuser", "channel1"))
+	newMessage(ts, createTestMessage("!checkguild testchar testrealm", "testuser", "channel1"))
+
+	if messages := ts.GetMessages("channel1"); len(messages) != 0 {
+		t.Errorf("Expected no plain text replies, got %v", messages)
+	}
+	embeds := ts.embeds["channel1"]
+	if len(embeds) != 2 {
+		t.Fatalf("Expected 2 embeds, got %d", len(embeds))
+	}
+
+	whoami := embeds[0]
+	if whoami.Title != "testchar - testrealm" || whoami.Color != classColors[8] {
+		t.Errorf("Unexpected whoami embed: %+v", whoami)
+	}
+	if whoami.Thumbnail == nil || whoami.Thumbnail.URL != "https://render.example/testchar-testrealm.jpg" {
+		t.Errorf("Expected avatar thumbnail, got %+v", whoami.Thumbnail)
+	}
+	fields := make(map[string]string)
+	for _, field := range whoami.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Level"] != "80" || fields["Class"] != "Mage" {
+		t.Errorf("Unexpected whoami fields: %v", fields)
+	}
+
+	if embeds[1].Description != "testchar-testrealm is in Stand and Deliver" {
+		t.Errorf("Unexpected checkguild description '%s'", embeds[1].Description)
+	}
+}
+
+// Test that slash commands send embeds in the interaction response
+// Test that the guild master's rank 0 is shown in the guild embed
+func TestGuildEmbedRankZero(t *testing.T) {
+	card := &characterCard{name: "leader", realm: "cenarius", summary: &blizzard.CharacterSummary{Name: "Leader"}}
+	embed := guildEmbed(card, &blizzard.GuildInfo{Name: "Stand and Deliver", Rank: 0}, "0")
+	for _, field := range embed.Fields {
+		if field.Name == "Level" {
+			t.Errorf("Expected no level field for an unknown level, got %s", field.Value)
+		}
+		if field.Name == "Rank" {
+			if field.Value != "0" {
+				t.Errorf("Expected rank 0, got %s", field.Value)
+			}
+			return
+		}
+	}
+	t.Error("Expected a rank field for the guild master")
+}
+
+func TestSlashWhoamiEmbed(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	addMockCharacter("testchar", "testrealm", false)
+	if err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "testuser", CharacterName: "testchar", Server: "testrealm"}); err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+
+	// Interaction responses carry embeds even where channel messages could not
+	newInteraction(ts, createTestInteraction("whoami", "testuser", "channel1", nil))
+	if len(ts.responses) != 1 || ts.responses[0].Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Fatalf("Expected a deferred response, got %+v", ts.responses)
+	}
+	if messages := ts.GetMessages("channel1"); len(messages) != 0 {
+		t.Errorf("Expected no plain text replies, got %v", messages)
+	}
+	if embeds := ts.embeds["channel1"]; len(embeds) != 1 || embeds[0].Title != "testchar - testrealm" {
+		t.Errorf("Expected a whoami embed follow-up, got %+v", embeds)
+	}
+}
+
+// Test !list-users filters, sorting, pagination and the CSV export
+func TestListUsers(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	NewMockBlizzardAPI()
+	addMockCharacter("char01", "cenarius", true)
+	if err := database.AddAdmin(db, "admin"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	for i := 0; i < 45; i++ {
+		realm := "Cenarius"
+		if i%3 == 0 {
+			realm = "Area 52"
+		}
+		reg := database.CharacterRegistration{
+			DiscordUsername: fmt.Sprintf("user%02d", i),
+			CharacterName:   fmt.Sprintf("char%02d", i),
+			Server:          realm,
+		}
+		if err := database.RegisterCharacter(db, reg); err != nil {
+			t.Fatalf("Failed to register character: %v", err)
+		}
+	}
+
+	run := func(command string) *TestSession {
+		ts := NewTestSession()
+		newMessage(ts, createTestMessage(command, "admin", "dm"))
+		return ts
+	}
+
+	ts := run("!list-users")
+	if len(ts.complex) != 1 {
+		t.Fatalf("Expected a paginated message, got %v", ts.GetMessages("dm"))
+	}
+	first := ts.complex[0]
+	if !strings.HasPrefix(first.Content, "Registered users (page 1/3, 45 total):") || len(first.Content) > 2000 {
+		t.Errorf("Expected first of three pages, got '%s'", first.Content)
+	}
+	if !strings.Contains(first.Content, "- user00: char00 on Area 52") || strings.Contains(first.Content, "user20") {
+		t.Errorf("Expected the first twenty users, got '%s'", first.Content)
+	}
+
+	// Pressing Next replaces the message with the second page
+	buttons := first.Components[0].(discordgo.ActionsRow).Components
+	next := buttons[1].(discordgo.Button)
+	if !buttons[0].(discordgo.Button).Disabled || next.Disabled {
+		t.Errorf("Expected only the Next button to be enabled on the first page")
+	}
+	press := func(userID string) *discordgo.InteractionResponse {
+		ts.responses = nil
+		newInteraction(ts, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+			Type:      discordgo.InteractionMessageComponent,
+			ChannelID: "dm",
+			Data:      discordgo.MessageComponentInteractionData{CustomID: next.CustomID, ComponentType: discordgo.ButtonComponent},
+			User:      &discordgo.User{ID: userID, Username: "admin"},
+		}})
+		if len(ts.responses) != 1 {
+			t.Fatalf("Expected one response, got %+v", ts.responses)
+		}
+		return ts.responses[0]
+	}
+	resp := press("test-user-id")
+	if resp.Type != discordgo.InteractionResponseUpdateMessage || !strings.HasPrefix(resp.Data.Content, "Registered users (page 2/3") {
+		t.Errorf("Expected the second page, got %+v", resp.Data)
+	}
+	if resp = press("someone-else"); resp.Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("Expected other users to be refused privately, got %+v", resp.Data)
+	}
+
+	ts = run(`!list-users realm:"area 52" sort:character prefix:char0`)
+	messages := ts.GetMessages("dm")
+	expected := "Registered users:\n- user00: char00 on Area 52\n- user03: char03 on Area 52\n- user06: char06 on Area 52\n- user09: char09 on Area 52\n"
+	if len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected filtered list '%s', got %v", expected, messages)
+	}
+
+	ts = run("!list-users guild:yes")
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || messages[0] != "Registered users:\n- user01: char01 on Cenarius\n" {
+		t.Errorf("Expected only the guild member, got %v", messages)
+	}
+
+	ts = run("!list-users guild:yes realm:area-52")
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || messages[0] != "No registered users match the filters" {
+		t.Errorf("Expected no guild members on Area 52, got %v", messages)
+	}
+
+	ts = run("!list-users sort:level")
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || !strings.HasPrefix(messages[0], "Usage: !list-users") {
+		t.Errorf("Expected usage error for an unknown sort order, got %v", messages)
+	}
+
+	ts = run("!list-users csv prefix:user1")
+	if len(ts.complex) != 1 || len(ts.complex[0].Files) != 1 {
+		t.Fatalf("Expected a CSV attachment, got %v", ts.GetMessages("dm"))
+	}
+	data, _ := io.ReadAll(ts.complex[0].Files[0].Reader)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 11 || lines[0] != "discord_username,character_name,realm" {
+		t.Errorf("Expected a header and ten rows, got %q", lines)
+	}
+}
+
+// Test that registrations match roster entries whatever form their realm was written in
+func TestRegistrationKey(t *testing.T) {
+	for _, realm := range []string{"Aggra (Português)", "aggra-portugues", "Aggra Portugues"} {
+		if key := registrationKey("Testchar", realm); key != "testchar-aggraportugues" {
+			t.Errorf("Expected key testchar-aggraportugues for %s, got %s", realm, key)
+		}
+	}
+}
+
+// Test that guild ranks map to their roles and that a new rank replaces the previous rank role
+func TestRankRoles(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		GuildRankRoleIDs:   map[int]string{0: "officer-role", 1: "officer-role", 3: "raider-role", 5: "social-role"},
+	})
+	defer Initialize(config.Config{})
+
+	// The mock reports rank 3 for guild members
+	addMockCharacter("testchar", "testrealm", true)
+	ts.roles["test-user-id"] = []string{"test-community-role", "social-role"}
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage("!register testchar testrealm", "testuser", "channel1"))
+
+	roles := strings.Join(ts.GetUserRoles("test-user-id"), ",")
+	if roles != "test-community-role,raider-role" {
+		t.Errorf("Expected the social role to be replaced by the raider role, got %s", roles)
+	}
+	messages := ts.GetMessages("channel1")
+	expected := "Granted roles: Guild Rank 3 Role\nRemoved roles: Previous Guild Rank Role"
+	if len(messages) != 2 || messages[1] != expected {
+		t.Errorf("Expected role update message '%s', got %v", expected, messages)
+	}
+
+	// Unmapped or unknown ranks fall back to the entry level guild role
+	member := &discordgo.Member{User: &discordgo.User{ID: "other-user", Username: "other"}}
+	msg, err := updateMemberRoles(ts, "test-guild", member, true, &cfg.Guilds()[0], -1, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if roles := strings.Join(ts.GetUserRoles("other-user"), ","); roles != "test-community-role,test-guild-role-1" {
+		t.Errorf("Expected community and entry level roles, got %s (%s)", roles, msg)
+	}
+}
+
+// Test that a demotion to a rank without a role removes the previous rank role, both on
+// registration and on reconciliation
+func TestDemotionToUnmappedRank(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		GuildRankRoleIDs:   map[int]string{1: "officer-role"},
+		DiscordGuildID:     "test-guild",
+	})
+	defer Initialize(config.Config{})
+
+	addMockCharacter("testchar", "testrealm", true)
+	currentMock.guildRanks["testchar-testrealm"] = 7
+	ts.roles["test-user-id"] = []string{"test-community-role", "officer-role"}
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage("!register testchar testrealm", "testuser", "channel1"))
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role,test-guild-role-1" {
+		t.Errorf("Expected the officer role to be replaced by the member role on registration, got %s", roles)
+	}
+
+	addMockCharacter("demoted", "cenarius", true)
+	currentMock.guildRanks["demoted-cenarius"] = 7
+	ts.roles["u1"] = []string{"test-community-role", "officer-role"}
+	err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "demoted", DiscordUserID: "u1", CharacterName: "demoted", Server: "cenarius"})
+	if err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	runReconciliation(context.Background(), ts)
+	if roles := strings.Join(ts.GetUserRoles("u1"), ","); roles != "test-community-role,test-guild-role-1" {
+		t.Errorf("Expected the officer role to be replaced by the member role on reconciliation, got %s", roles)
+	}
+}
+
+// Test that members of any tracked guild get that guild's roles, and that moving to
+// another tracked guild swaps them
+func TestTrackedGuilds(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID: "test-community-role",
+		DiscordGuildID:  "test-guild",
+		TrackedGuilds: []config.TrackedGuild{
+			{Name: "Stand and Deliver", Realm: "Cenarius", ID: 70395110, MemberRoleIDs: []string{"snd-role"}},
+			{Name: "Second Wind", Realm: "Area 52", MemberRoleIDs: []string{"wind-role"}, RankRoleIDs: map[int]string{3: "wind-raider-role"}},
+		},
+	})
+	defer Initialize(config.Config{})
+
+	addMockCharacter("windy", "area-52", true)
+	currentMock.characterGuilds["windy-area-52"] = &blizzard.Guild{
+		Name:  "Second Wind",
+		ID:    12345,
+		Realm: blizzard.Realm{Name: "Area 52", Slug: "area-52"},
+	}
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage("!register windy area-52", "testuser", "channel1"))
+	messages := ts.GetMessages("channel1")
+	if len(messages) == 0 || messages[0] != "Successfully registered character windy on server area-52 (Second Wind member)" {
+		t.Errorf("Expected registration as a Second Wind member, got %v", messages)
+	}
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role,wind-raider-role" {
+		t.Errorf("Expected the Second Wind rank role, got %s", roles)
+	}
+
+	newMessage(ts, createTestMessage("!checkguild windy area-52", "testuser", "channel2"))
+	if messages := ts.GetMessages("channel2"); len(messages) != 1 || messages[0] != "windy-area-52 is in Second Wind" {
+		t.Errorf("Expected windy to be in Second Wind, got %v", messages)
+	}
+
+	// Moving to Stand and Deliver swaps the guild roles on the next reconciliation
+	delete(currentMock.characterGuilds, "windy-area-52")
+	runReconciliation(context.Background(), ts)
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role,snd-role" {
+		t.Errorf("Expected the Second Wind roles to be replaced by Stand and Deliver's, got %s", roles)
+	}
+
+	// Registering a character of another tracked guild, or of none, swaps the roles right away
+	addMockCharacter("gusty", "area-52", true)
+	currentMock.characterGuilds["gusty-area-52"] = &blizzard.Guild{
+		Name:  "Second Wind",
+		ID:    12345,
+		Realm: blizzard.Realm{Name: "Area 52", Slug: "area-52"},
+	}
+	newMessage(ts, createTestMessage("!register gusty area-52", "testuser", "channel4"))
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role,wind-raider-role" {
+		t.Errorf("Expected the Stand and Deliver role to be replaced by Second Wind's on registration, got %s", roles)
+	}
+
+	addMockCharacter("loner", "cenarius", false)
+	newMessage(ts, createTestMessage("!register loner cenarius", "testuser", "channel4"))
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role" {
+		t.Errorf("Expected the Second Wind roles to be removed on registration outside the tracked guilds, got %s", roles)
+	}
+	messages = ts.GetMessages("channel4")
+	if len(messages) != 4 || messages[3] != "Removed roles: Guild Rank Role" {
+		t.Errorf("Expected the removed guild role to be reported, got %v", messages)
+	}
+
+	newMessage(ts, createTestMessage("!checkguild loner cenarius", "testuser", "channel3"))
+	if messages := ts.GetMessages("channel3"); len(messages) != 1 || messages[0] != "loner-cenarius is not in any of our guilds (Stand and Deliver, Second Wind)" {
+		t.Errorf("Expected loner to be in no tracked guild, got %v", messages)
+	}
+}
+
+// Test that new members are sent registration instructions and welcomed in the welcome
+// channel, and that returning members get their roles back
+func TestMemberJoin(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		DiscordGuildID:     "test-guild",
+		WelcomeChannelID:   "welcome-channel",
+		WelcomeMessage:     "Say hi to {user} ({username}) in {server}",
+	})
+	defer Initialize(config.Config{})
+
+	join := func(userID, username string) {
+		user := &discordgo.User{ID: userID, Username: username}
+		handleMemberJoin(ts, &discordgo.GuildMemberAdd{Member: &discordgo.Member{GuildID: "test-guild", User: user}})
+	}
+
+	join("new-id", "newcomer")
+	if messages := ts.GetMessages("dm-new-id"); len(messages) != 1 || !strings.Contains(messages[0], "!register <character> <realm>") {
+		t.Errorf("Expected registration instructions, got %v", messages)
+	}
+	if messages := ts.GetMessages("welcome-channel"); len(messages) != 1 || messages[0] != "Say hi to <@new-id> (newcomer) in the server" {
+		t.Errorf("Expected the templated welcome message, got %v", messages)
+	}
+
+	addMockCharacter("returner", "cenarius", true)
+	err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "returner", DiscordUserID: "back-id", CharacterName: "returner", Server: "cenarius"})
+	if err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	join("back-id", "returner")
+	if roles := strings.Join(ts.GetUserRoles("back-id"), ","); roles != "test-community-role,test-guild-role-1" {
+		t.Errorf("Expected the returning member's roles to be restored, got %s", roles)
+	}
+	if messages := ts.GetMessages("dm-back-id"); len(messages) != 1 || !strings.HasPrefix(messages[0], "Welcome back") {
+		t.Errorf("Expected a welcome back message, got %v", messages)
+	}
+
+	// A registration made under the same username by another account is left alone
+	join("imposter-id", "returner")
+	if roles := ts.GetUserRoles("imposter-id"); len(roles) != 0 {
+		t.Errorf("Expected no roles for a different account, got %v", roles)
+	}
+
+	// Members who changed their username are found by their user ID
+	join("back-id", "renamed")
+	if messages := ts.GetMessages("dm-back-id"); len(messages) != 2 || !strings.HasPrefix(messages[1], "Welcome back") {
+		t.Errorf("Expected a renamed member to be welcomed back, got %v", messages)
+	}
+}
+
+// Test that members leaving mark their registration as departed, that rejoining clears
+// it, and that admins can list and purge departed users
+func TestMemberLeave(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:     "test-community-role",
+		DiscordGuildID:      "test-guild",
+		DepartedGracePeriod: 30 * 24 * time.Hour,
+	})
+	defer Initialize(config.Config{})
+
+	if err := database.AddAdmin(db, "admin"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	addMockCharacter("leaver", "cenarius", false)
+	for _, reg := range []database.CharacterRegistration{
+		{DiscordUsername: "leaver", DiscordUserID: "leaver-id", CharacterName: "leaver", Server: "cenarius"},
+		{DiscordUsername: "stayer", DiscordUserID: "stayer-id", CharacterName: "stayer", Server: "cenarius"},
+	} {
+		if err := database.RegisterCharacter(db, reg); err != nil {
+			t.Fatalf("Failed to register character: %v", err)
+		}
+	}
+	member := func(userID, username string) *discordgo.Member {
+		return &discordgo.Member{GuildID: "test-guild", User: &discordgo.User{ID: userID, Username: username}}
+	}
+	admin := func(command string) []string {
+		ts := NewTestSession()
+		newMessage(ts, createTestMessage(command, "admin", "dm"))
+		return ts.GetMessages("dm")
+	}
+
+	// Another account using a registered username does not affect the registration
+	handleMemberLeave(ts, &discordgo.GuildMemberRemove{Member: member("other-id", "stayer")})
+	handleMemberLeave(ts, &discordgo.GuildMemberRemove{Member: member("leaver-id", "leaver")})
+
+	messages := admin("!departed")
+	purgeDate := time.Now().Add(30 * 24 * time.Hour).UTC().Format("2006-01-02")
+	if len(messages) != 1 || messages[0] != "Registered users who left the server:\n- leaver: leaver on cenarius, left "+time.Now().UTC().Format("2006-01-02")+", purged after "+purgeDate {
+		t.Errorf("Expected only leaver to be listed, got %v", messages)
+	}
+
+	// Rejoining makes the registration active again
+	handleMemberJoin(ts, &discordgo.GuildMemberAdd{Member: member("leaver-id", "leaver")})
+	if messages := admin("!departed"); len(messages) != 1 || messages[0] != "No registered users have left the server" {
+		t.Errorf("Expected no departed users after rejoining, got %v", messages)
+	}
+
+	// Members who changed their username are found by their user ID
+	handleMemberLeave(ts, &discordgo.GuildMemberRemove{Member: member("leaver-id", "renamed")})
+	if messages := admin("!purge-departed stayer"); len(messages) != 1 || !strings.Contains(messages[0], "has not left the server") {
+		t.Errorf("Expected active registrations not to be purged, got %v", messages)
+	}
+	if messages := admin("!purge-departed"); len(messages) != 1 || messages[0] != "Purged the registrations of departed users: leaver" {
+		t.Errorf("Expected leaver to be purged, got %v", messages)
+	}
+	if reg, _ := database.GetCharacter(db, "leaver"); reg != nil {
+		t.Errorf("Expected the departed registration to be deleted, got %+v", reg)
+	}
+	if reg, _ := database.GetCharacter(db, "stayer"); reg == nil {
+		t.Error("Expected the active registration to be kept")
+	}
+
+	// A user who rejoined after the departed registrations were listed is not purged
+	if err := database.MarkRegistrationLeft(db, "stayer", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to mark registration as departed: %v", err)
+	}
+	if err := database.MarkRegistrationActive(db, "stayer"); err != nil {
+		t.Fatalf("Failed to mark registration as active: %v", err)
+	}
+	if deleted, err := database.PurgeDepartedRegistration(db, "stayer", time.Now()); err != nil || deleted {
+		t.Errorf("Expected the rejoined registration not to be purged, got %v, %v", deleted, err)
+	}
+
+	var events []string
+	rows, err := db.Query("SELECT event FROM audit_log ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event string
+		rows.Scan(&event)
+		events = append(events, event)
+	}
+	if got := strings.Join(events, ","); got != "left,rejoined,left,purged" {
+		t.Errorf("Expected audit events left,rejoined,left,purged, got %s", got)
+	}
+}
+
+// Test that reconciliation grants and revokes roles to match guild membership and
+// reports the changes to the admin channel
+func TestReconcileRoles(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		DiscordGuildID:     "test-guild",
+		AdminChannelID:     "admin-channel",
+	})
+	defer Initialize(config.Config{})
+
+	addMockCharacter("joiner", "cenarius", true)
+	addMockCharacter("leaver", "cenarius", false)
+	addMockCharacter("steady", "cenarius", true)
+	ts.roles["u2"] = []string{"test-community-role", "test-guild-role-1"}
+	ts.roles["u3"] = []string{"test-community-role"}
+	ts.roles["u4"] = []string{"test-community-role", "test-guild-role-1"}
+	// The deleted character's registration predates stored user IDs
+	ts.usernames = map[string]string{"deleted": "u3"}
+
+	for _, reg := range []database.CharacterRegistration{
+		{DiscordUsername: "joiner", DiscordUserID: "u1", CharacterName: "joiner", Server: "cenarius"},
+		{DiscordUsername: "leaver", DiscordUserID: "u2", CharacterName: "leaver", Server: "cenarius"},
+		{DiscordUsername: "deleted", CharacterName: "deleted", Server: "cenarius"},
+		{DiscordUsername: "steady", DiscordUserID: "u4", CharacterName: "steady", Server: "cenarius"},
+		{DiscordUsername: "stranger", CharacterName: "steady", Server: "cenarius"},
+	} {
+		if err := database.RegisterCharacter(db, reg); err != nil {
+			t.Fatalf("Failed to register character: %v", err)
+		}
+	}
+
+	runReconciliation(context.Background(), ts)
+
+	expectedRoles := map[string]string{
+		"u1": "test-community-role,test-guild-role-1",
+		"u2": "test-community-role",
+		"u3": "",
+		"u4": "test-community-role,test-guild-role-1",
+	}
+	for userID, expected := range expectedRoles {
+		if roles := strings.Join(ts.GetUserRoles(userID), ","); roles != expected {
+			t.Errorf("Expected roles '%s' for %s, got '%s'", expected, userID, roles)
+		}
+	}
+
+	messages := ts.GetMessages("admin-channel")
+	if len(messages) != 1 {
+		t.Fatalf("Expected one summary in the admin channel, got %v", messages)
+	}
+	for _, want := range []string{
+		"checked 5 registrations: 3 changed, 1 skipped, 0 failed",
+		"- joiner (joiner on cenarius): granted Community Role, Guild Member Role",
+		"- leaver (leaver on cenarius): removed Guild Member Role",
+		"- deleted (deleted on cenarius): removed Community Role",
+		"- stranger: skipped, not found in the Discord server",
+	} {
+		if !strings.Contains(messages[0], want) {
+			t.Errorf("Expected summary to contain '%s', got '%s'", want, messages[0])
+		}
+	}
+
+	reg, err := database.GetCharacter(db, "deleted")
+	if err != nil || reg == nil || reg.DiscordUserID != "u3" {
+		t.Errorf("Expected the user ID found by username to be stored, got %+v (%v)", reg, err)
+	}
+
+	// Nothing is posted when no roles change
+	ts.messages = make(map[string][]string)
+	runReconciliation(context.Background(), ts)
+	if messages := ts.GetMessages("admin-channel"); len(messages) != 0 {
+		t.Errorf("Expected no summary without changes, got %v", messages)
+	}
+}
+
+// Test that !unregister and admin !remove-user delete the registration and strip the bot's roles
+func TestUnregister(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		GuildRankRoleIDs:   map[int]string{3: "raider-role"},
+		DiscordGuildID:     "test-guild",
+	})
+	defer Initialize(config.Config{})
+
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+	newMessage(ts, createTestMessage("!unregister", "testuser", "channel1"))
+	if messages := ts.GetMessages("channel1"); len(messages) != 1 || messages[0] != "You don't have a registered character." {
+		t.Errorf("Expected no registration message, got %v", messages)
+	}
+
+	if err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "testuser", CharacterName: "testchar", Server: "testrealm"}); err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	ts.roles["test-user-id"] = []string{"test-community-role", "raider-role", "unrelated-role"}
+	ts.messages = make(map[string][]string)
+
+	newMessage(ts, createTestMessage("!unregister", "testuser", "channel1"))
+	expected := "Unregistered character testchar on server testrealm\nRemoved roles: Community Role, Guild Rank Role"
+	if messages := ts.GetMessages("channel1"); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected message '%s', got %v", expected, messages)
+	}
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "unrelated-role" {
+		t.Errorf("Expected only roles the bot does not manage to remain, got %s", roles)
+	}
+	if reg, _ := database.GetCharacter(db, "testuser"); reg != nil {
+		t.Errorf("Expected registration to be removed, got %+v", reg)
+	}
+
+	// Admins remove other users' registrations from a DM, in the configured server
+	if err := database.AddAdmin(db, "admin"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	if err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "other", DiscordUserID: "other-id", CharacterName: "otherchar", Server: "testrealm"}); err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	ts.roles["other-id"] = []string{"test-community-role", "test-guild-role-1"}
+	ts.SetChannelType(discordgo.ChannelTypeDM)
+
+	newMessage(ts, createTestMessage("!remove-user other", "admin", "dm"))
+	expected = "Successfully removed registration for other\nRemoved roles: Community Role, Guild Member Role"
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected message '%s', got %v", expected, messages)
+	}
+	if roles := ts.GetUserRoles("other-id"); len(roles) != 0 {
+		t.Errorf("Expected all roles to be removed, got %v", roles)
+	}
+
+	// Without a configured server, unregistering from a DM says the roles were kept
+	cfg.DiscordGuildID = ""
+	if err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "testuser", CharacterName: "testchar", Server: "testrealm"}); err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	ts.roles["test-user-id"] = []string{"test-community-role"}
+	newMessage(ts, createTestMessage("!unregister", "testuser", "dm2"))
+	if messages := ts.GetMessages("dm2"); len(messages) != 1 || !strings.Contains(messages[0], "your roles were not removed") {
+		t.Errorf("Expected the kept roles to be reported, got %v", messages)
+	}
+	if roles := ts.GetUserRoles("test-user-id"); len(roles) != 1 {
+		t.Errorf("Expected the roles to be kept, got %v", roles)
+	}
+}
+
+// Test that role rules grant and revoke roles on registration and can be checked without changes
+func TestRoleRules(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	officerRank := 1
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		RoleRules: []config.RoleRule{
+			{Name: "KSM", RoleID: "ksm-role", MinMythicRating: 2000},
+			{Name: "Horde", RoleID: "horde-role", Faction: "horde"},
+			{Name: "Cutting Edge", RoleID: "ce-role", Achievements: []int{40253}},
+			{Name: "Officer", RoleID: "officer-role", MaxGuildRank: &officerRank},
+			{Name: "Max Level", RoleID: "max-role", MinLevel: 80, Classes: []string{"mage", "priest"}},
+		},
+	})
+	defer Initialize(config.Config{})
+
+	// The mock character is a level 80 mage with a 2450 rating at guild rank 3
+	addMockCharacter("testchar", "testrealm", true)
+	ts.roles["test-user-id"] = []string{"horde-role"}
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage("!register testchar testrealm", "testuser", "channel1"))
+
+	roles := strings.Join(ts.GetUserRoles("test-user-id"), ",")
+	if roles != "test-community-role,test-guild-role-1,ksm-role,ce-role,max-role" {
+		t.Errorf("Expected rule roles to be granted and the Horde role revoked, got %s", roles)
+	}
+	messages := ts.GetMessages("channel1")
+	expected := "Granted roles: Community Role, Guild Member Role, KSM, Cutting Edge, Max Level\nRemoved roles: Horde"
+	if len(messages) != 2 || messages[1] != expected {
+		t.Errorf("Expected role update message '%s', got %v", expected, messages)
+	}
+
+	// The dry run explains each rule without touching roles
+	if err := database.AddAdmin(db, "admin"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	ts.SetChannelType(discordgo.ChannelTypeDM)
+	newMessage(ts, createTestMessage("!check-rules testuser", "admin", "dm"))
+	expected = "Role rules for testuser (testchar on testrealm):\n" +
+		"- KSM: matches\n" +
+		"- Horde: does not match (faction is unknown, not horde)\n" +
+		"- Cutting Edge: matches\n" +
+		"- Officer: does not match (guild rank 3 is lower than rank 1)\n" +
+		"- Max Level: matches"
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected dry run '%s', got %v", expected, messages)
+	}
+	if after := strings.Join(ts.GetUserRoles("test-user-id"), ","); after != roles {
+		t.Errorf("Expected the dry run to leave roles unchanged, got %s", after)
+	}
+
+	// Only the current season's rating counts, so a character who has not played it yet
+	// does not match the KSM rule whatever their rating was last season
+	addMockCharacter("veteran", "testrealm", true)
+	currentMock.mythicRatings["veteran-testrealm"] = 0
+	err := database.RegisterCharacter(db, database.CharacterRegistration{DiscordUsername: "veteranuser", CharacterName: "veteran", Server: "testrealm"})
+	if err != nil {
+		t.Fatalf("Failed to register character: %v", err)
+	}
+	newMessage(ts, createTestMessage("!check-rules veteranuser", "admin", "dm"))
+	if messages := ts.GetMessages("dm"); len(messages) != 2 || !strings.Contains(messages[1], "- KSM: does not match (Mythic+ rating 0 is below 2000)") {
+		t.Errorf("Expected the KSM rule not to match without a current season rating, got %v", messages)
+	}
+
+	// Unregistering strips rule roles along with the guild roles
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+	newMessage(ts, createTestMessage("!unregister", "testuser", "channel1"))
+	if roles := ts.GetUserRoles("test-user-id"); len(roles) != 0 {
+		t.Errorf("Expected all roles to be removed, got %v", roles)
+	}
+}
+
+// Test that roles of rank based rules are kept when the guild rank cannot be determined,
+// so that a failing roster lookup never revokes them
+func TestRoleRulesUnknownRank(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	officerRank := 1
+	Initialize(config.Config{
+		CommunityRoleID:    "test-community-role",
+		GuildMemberRoleIDs: []string{"test-guild-role-1"},
+		RoleRules:          []config.RoleRule{{Name: "Officer", RoleID: "officer-role", MaxGuildRank: &officerRank}},
+	})
+	defer Initialize(config.Config{})
+
+	addMockCharacter("testchar", "testrealm", true)
+	currentMock.guildRanks["testchar-testrealm"] = -1
+	ts.roles["test-user-id"] = []string{"test-community-role", "test-guild-role-1", "officer-role"}
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage("!register testchar testrealm", "testuser", "channel1"))
+	if roles := strings.Join(ts.GetUserRoles("test-user-id"), ","); roles != "test-community-role,test-guild-role-1,officer-role" {
+		t.Errorf("Expected the officer role to be kept with an unknown rank, got %s", roles)
+	}
+
+	if err := database.AddAdmin(db, "admin"); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	ts.SetChannelType(discordgo.ChannelTypeDM)
+	newMessage(ts, createTestMessage("!check-rules testuser", "admin", "dm"))
+	expected := "Role rules for testuser (testchar on testrealm):\n- Officer: does not match (guild rank is unknown), role left unchanged"
+	if messages := ts.GetMessages("dm"); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected dry run '%s', got %v", expected, messages)
+	}
+}
+
+// Test that class conditions match the class ID, whatever the locale of the class name
+func TestRoleRuleClasses(t *testing.T) {
+	facts := &ruleFacts{classID: 8, class: "Magier"}
+
+	if unmet := unmetConditions(config.RoleRule{Classes: []string{"priest", "Mage"}}, facts); len(unmet) != 0 {
+		t.Errorf("Expected a localized mage to match the mage class, got %v", unmet)
+	}
+	unmet := unmetConditions(config.RoleRule{Classes: []string{"priest"}}, facts)
+	if len(unmet) != 1 || unmet[0] != "class Magier is not one of priest" {
+		t.Errorf("Expected the class condition to be unmet, got %v", unmet)
+	}
+
+	if err := validateRoleRules([]config.RoleRule{{Name: "Casters", Classes: []string{"Mage", "death knight"}}}); err != nil {
+		t.Errorf("Expected known classes to be accepted, got %v", err)
+	}
+	if err := validateRoleRules([]config.RoleRule{{Name: "Casters", Classes: []string{"Magier"}}}); err == nil {
+		t.Error("Expected an unknown class to be rejected")
+	}
+}
+
+// Test that registration sets the member's nickname to their character, and that the
+// server owner, who cannot be renamed, is told so
+func TestNicknameSync(t *testing.T) {
+	db = setupTestDB(t)
+	defer db.Close()
+
+	ts := NewTestSession()
+	NewMockBlizzardAPI()
+	Initialize(config.Config{
+		CommunityRoleID:      "test-community-role",
+		DiscordGuildID:       "test-guild",
+		SyncNicknames:        true,
+		NicknameIncludeRealm: true,
+	})
+	defer Initialize(config.Config{})
+
+	addMockCharacter("testchar", "area 52", false)
+	addMockCharacter("ownerchar", "area 52", false)
+	ts.SetChannelType(discordgo.ChannelTypeGuildText)
+
+	newMessage(ts, createTestMessage(`!register testchar "area 52"`, "testuser", "channel1"))
+	if nickname := ts.nicknames["test-user-id"]; nickname != "Testchar-Area52" {
+		t.Errorf("Expected nickname 'Testchar-Area52', got '%s'", nickname)
+	}
+	messages := ts.GetMessages("channel1")
+	if len(messages) != 2 || !strings.HasSuffix(messages[1], "\nNickname set to Testchar-Area52") {
+		t.Errorf("Expected the nickname change to be reported, got %v", messages)
+	}
+
+	msg := createTestMessage(`!register ownerchar "area 52"`, "owner", "channel2")
+	msg.Author.ID = "owner-id"
+	newMessage(ts, msg)
+	messages = ts.GetMessages("channel2")
+	if len(messages) != 2 || !strings.Contains(messages[1], "nickname was not changed because the bot lacks permission") {
+		t.Errorf("Expected the missing permission to be explained, got %v", messages)
+	}
+
+	// Reconciliation leaves correct nicknames alone and skips members it may not rename
+	summary, err := reconcileRoles(context.Background(), ts, "test-guild")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(summary.changed) != 0 || len(summary.failed) != 0 {
+		t.Errorf("Expected no changes or failures, got %s", summary)
+	}
+
+	if nickname := characterNickname("averyveryverylongname", "The Scryers And Others"); nickname != "Averyveryverylongname-TheScryers" {
+		t.Errorf("Expected the nickname to be cut to 32 characters, got '%s'", nickname)
+	}
+}
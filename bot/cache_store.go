@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/bezerker/sndbot/blizzard"
+	database "github.com/bezerker/sndbot/database"
+)
+
+// apiCacheRetention is how long expired responses are kept for conditional revalidation
+const apiCacheRetention = 7 * 24 * time.Hour
+
+// dbCacheStore persists Blizzard API responses in the bot's database
+type dbCacheStore struct {
+	db *sql.DB
+}
+
+func (s dbCacheStore) LoadCacheEntry(key string) (*blizzard.CacheEntry, error) {
+	entry, err := database.GetAPICacheEntry(s.db, key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return &blizzard.CacheEntry{
+		Key:          entry.CacheKey,
+		Body:         entry.Body,
+		LastModified: entry.LastModified,
+		ExpiresAt:    entry.ExpiresAt,
+	}, nil
+}
+
+func (s dbCacheStore) SaveCacheEntry(entry blizzard.CacheEntry) error {
+	return database.SaveAPICacheEntry(s.db, database.APICacheEntry{
+		CacheKey:     entry.Key,
+		Body:         entry.Body,
+		LastModified: entry.LastModified,
+		ExpiresAt:    entry.ExpiresAt,
+	})
+}
@@ -0,0 +1,345 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// permission is the access level a command requires
+type permission int
+
+const (
+	permissionEveryone permission = iota
+	// permissionAdmin commands are only available to users in the admins table
+	permissionAdmin
+)
+
+// commandScope restricts where a command may be used
+type commandScope int
+
+const (
+	scopeAnywhere commandScope = iota
+	scopeDM
+	scopeGuild
+)
+
+// argumentKind says how an argument is read from the command line
+type argumentKind int
+
+const (
+	// argString is a single word, or a quoted phrase
+	argString argumentKind = iota
+	// argCharacter is a character and realm in any form accepted by parseCharacter. It
+	// consumes the rest of the arguments and is stored as the "character" and "realm" params.
+	argCharacter
+	// argNamed is an optional name:value pair that may appear anywhere, e.g. realm:cenarius
+	argNamed
+	// argFlag is an optional bare word such as "csv", stored as "true" when present
+	argFlag
+	// argUser is a Discord username; slash commands take it as a user option
+	argUser
+)
+
+// argument describes one argument of a command
+type argument struct {
+	name        string
+	description string
+	kind        argumentKind
+	required    bool
+	// choices restricts the accepted values, compared case-insensitively
+	choices []string
+}
+
+// command describes a bot command. Dispatch, usage errors, help output and slash
+// command definitions are all generated from this metadata.
+type command struct {
+	name        string
+	aliases     []string
+	description string
+	args        []argument
+	permission  permission
+	scope       commandScope
+	// timeout overrides defaultCommandTimeout for commands that call the Blizzard API;
+	// slash invocations of these commands are answered with a deferred response
+	timeout time.Duration
+	handler func(c *commandContext)
+}
+
+// commands lists every command in the order shown by !help and !admin-help
+var commands []*command
+
+// commandIndex maps "!name" and "!alias" to their command
+var commandIndex map[string]*command
+
+func init() {
+	commands = []*command{
+		{name: "help", description: "Show this help message", handler: handleHelp},
+		{name: "register", description: "Register your character", args: characterArgs(true), timeout: 30 * time.Second, handler: handleRegister},
+		{name: "unregister", description: "Remove your registered character and the roles it granted", handler: handleUnregister},
+		{name: "whoami", description: "Show your registered character", timeout: 20 * time.Second, handler: handleWhoami},
+		{name: "guild", description: "Show your guild information", timeout: 20 * time.Second, handler: handleGuild},
+		{name: "ping", description: "Pong", handler: handlePing},
+		{name: "bye", description: "Say goodbye", handler: handleBye},
+		{name: "checkguild", description: "Check which of our guilds a character is in", args: characterArgs(true), timeout: 20 * time.Second, handler: handleCheckGuild},
+		{name: "mplus", aliases: []string{"m+"}, description: "Show Mythic+ rating and best runs (defaults to your character)", args: characterArgs(false), timeout: 20 * time.Second, handler: handleMythicPlus},
+		{name: "progress", aliases: []string{"prog"}, description: "Show current raid tier progression (defaults to your character)", args: characterArgs(false), timeout: 20 * time.Second, handler: handleProgress},
+		{name: "gear", aliases: []string{"ilvl"}, description: "Show item levels, missing enchants and empty sockets (defaults to your character)", args: characterArgs(false), timeout: 20 * time.Second, handler: handleGear},
+
+		{name: "admin-help", description: "Show this help message", permission: permissionAdmin, scope: scopeDM, handler: handleAdminHelp},
+		{name: "addadmin", description: "Add a new admin", args: usernameArgs(), permission: permissionAdmin, scope: scopeDM, handler: handleAddAdmin},
+		{name: "removeadmin", description: "Remove an admin", args: usernameArgs(), permission: permissionAdmin, scope: scopeDM, handler: handleRemoveAdmin},
+		{name: "register-user", description: "Register a character for a user", args: append(usernameArgs(), characterArgs(true)...), permission: permissionAdmin, scope: scopeDM, handler: handleRegisterUser},
+		{name: "remove-user", description: "Remove a user's registration", args: usernameArgs(), permission: permissionAdmin, scope: scopeDM, handler: handleRemoveUser},
+		{name: "list-users", description: "List registered users, optionally filtered, sorted or as a CSV file", args: listUsersArgs, permission: permissionAdmin, scope: scopeDM, timeout: 20 * time.Second, handler: handleListUsers},
+		{name: "departed", description: "List registered users who left the server", permission: permissionAdmin, scope: scopeDM, handler: handleDeparted},
+		{name: "purge-departed", description: "Delete the registrations of users who left the server, or of one such user", args: []argument{{name: "discord_username", description: "Discord username", kind: argUser}}, permission: permissionAdmin, scope: scopeDM, handler: handlePurgeDeparted},
+		{name: "check-rules", description: "Show which role rules a user's character matches, without changing roles", args: usernameArgs(), permission: permissionAdmin, scope: scopeDM, timeout: 20 * time.Second, handler: handleCheckRules},
+		{name: "reconcile", description: "Re-verify all registrations and update roles now", permission: permissionAdmin, scope: scopeDM, timeout: reconcileTimeout, handler: handleReconcile},
+		{name: "api-quota", description: "Show Blizzard API quota usage", permission: permissionAdmin, scope: scopeDM, handler: handleAPIQuota},
+	}
+
+	commandIndex = make(map[string]*command)
+	for _, cmd := range commands {
+		commandIndex["!"+cmd.name] = cmd
+		for _, alias := range cmd.aliases {
+			commandIndex["!"+alias] = cmd
+		}
+	}
+}
+
+// characterArgs is the argument of commands that take a character. Optional characters
+// default to the caller's registered character.
+func characterArgs(required bool) []argument {
+	return []argument{{
+		name:        "character",
+		description: "Character name, Name-Realm or a link to the character's armory page",
+		kind:        argCharacter,
+		required:    required,
+	}}
+}
+
+// usernameArgs is the argument of admin commands that target a Discord user
+func usernameArgs() []argument {
+	return []argument{{name: "discord_username", description: "Discord username", kind: argUser, required: true}}
+}
+
+// lookupCommand returns the command for a "!name" or "!alias", or nil
+func lookupCommand(name string) *command {
+	return commandIndex[strings.ToLower(name)]
+}
+
+// usage returns the command's usage line, e.g. "!register <character> <realm>"
+func (cmd *command) usage() string {
+	parts := []string{"!" + cmd.name}
+	for _, arg := range cmd.args {
+		switch {
+		case arg.kind == argCharacter && arg.required:
+			parts = append(parts, "<character> <realm>")
+		case arg.kind == argCharacter:
+			parts = append(parts, "[character realm]")
+		case arg.kind == argNamed && len(arg.choices) > 0:
+			parts = append(parts, fmt.Sprintf("[%s:%s]", arg.name, strings.Join(arg.choices, "|")))
+		case arg.kind == argNamed:
+			parts = append(parts, fmt.Sprintf("[%s:<%s>]", arg.name, arg.name))
+		case arg.kind == argFlag:
+			parts = append(parts, fmt.Sprintf("[%s]", arg.name))
+		case arg.required:
+			parts = append(parts, fmt.Sprintf("<%s>", arg.name))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s]", arg.name))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// usageError returns the reply for arguments that do not match the command's schema
+func (cmd *command) usageError() string {
+	msg := "Usage: " + cmd.usage()
+	for _, arg := range cmd.args {
+		if arg.kind == argCharacter {
+			msg += " (or Name-Realm, or a link to the character's armory page)"
+			break
+		}
+	}
+	return msg
+}
+
+// parseArgs reads the arguments after the command name according to the schema.
+// Named arguments and flags are picked out first; the rest are read in order.
+func (cmd *command) parseArgs(args []string) (map[string]string, bool) {
+	params := make(map[string]string)
+
+	var positional []string
+	for _, word := range args {
+		arg, value, ok := cmd.optionalArg(word)
+		if !ok {
+			positional = append(positional, word)
+			continue
+		}
+		if len(arg.choices) > 0 {
+			value = strings.ToLower(value)
+			if !containsString(arg.choices, value) {
+				return nil, false
+			}
+		}
+		params[arg.name] = value
+	}
+	args = positional
+
+	for _, arg := range cmd.args {
+		if arg.kind == argNamed || arg.kind == argFlag {
+			continue
+		}
+		if len(args) == 0 {
+			if arg.required {
+				return nil, false
+			}
+			continue
+		}
+
+		switch arg.kind {
+		case argCharacter:
+			name, realm, ok := parseCharacter(args)
+			if !ok {
+				return nil, false
+			}
+			params["character"], params["realm"] = name, realm
+			args = nil
+		default:
+			params[arg.name] = args[0]
+			args = args[1:]
+		}
+	}
+	return params, len(args) == 0
+}
+
+// optionalArg matches a word against the command's named arguments and flags
+func (cmd *command) optionalArg(word string) (argument, string, bool) {
+	for _, arg := range cmd.args {
+		switch arg.kind {
+		case argNamed:
+			if name, value, found := strings.Cut(word, ":"); found && strings.EqualFold(name, arg.name) && value != "" {
+				return arg, value, true
+			}
+		case argFlag:
+			if strings.EqualFold(word, arg.name) {
+				return arg, "true", true
+			}
+		}
+	}
+	return argument{}, "", false
+}
+
+// containsString reports whether the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutOrDefault returns how long the command may spend on external calls
+func (cmd *command) timeoutOrDefault() time.Duration {
+	if cmd.timeout > 0 {
+		return cmd.timeout
+	}
+	return defaultCommandTimeout
+}
+
+// newCommandContext returns a context for handling the command, derived from the
+// bot's shutdown context and bounded by the command's deadline
+func newCommandContext(cmd *command) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(botCtx, cmd.timeoutOrDefault())
+}
+
+// allowed reports whether the caller may run the command here. It returns a reason
+// when the command is refused.
+func (cmd *command) allowed(c *commandContext) (bool, string) {
+	if cmd.scope != scopeAnywhere {
+		channel, err := c.session.Channel(c.channelID)
+		if err != nil {
+			util.Logger.Printf("Error getting channel info: %v", err)
+			return false, "Could not determine where this command was sent."
+		}
+		isDM := channel.Type == discordgo.ChannelTypeDM
+		if cmd.scope == scopeDM && !isDM {
+			return false, "This command is only available in DMs."
+		}
+		if cmd.scope == scopeGuild && isDM {
+			return false, "This command is only available in a server channel."
+		}
+	}
+
+	if cmd.permission == permissionAdmin {
+		isAdmin, err := database.IsAdmin(db, c.user.Username)
+		if err != nil {
+			util.Logger.Printf("Error checking admin status: %v", err)
+			return false, fmt.Sprintf("Error checking admin status: %v", err)
+		}
+		if !isAdmin {
+			return false, "This command is only available to bot admins."
+		}
+	}
+	return true, ""
+}
+
+// dispatch checks access, parses the arguments and runs the command. Refusals of
+// admin commands are only reported when reportRefusal is set, so that chat messages
+// do not reveal admin commands to other users.
+func dispatch(c *commandContext, cmd *command, reportRefusal bool) {
+	if ok, reason := cmd.allowed(c); !ok {
+		if reportRefusal || cmd.permission != permissionAdmin {
+			c.reply(reason)
+		}
+		return
+	}
+
+	params, ok := cmd.parseArgs(c.args[1:])
+	if !ok {
+		c.reply(cmd.usageError())
+		return
+	}
+	c.command = cmd
+	c.params = params
+
+	ctx, cancel := newCommandContext(cmd)
+	defer cancel()
+	c.ctx = ctx
+
+	cmd.handler(c)
+}
+
+// helpText lists the commands available at the given permission level
+func helpText(header string, level permission) string {
+	var help strings.Builder
+	help.WriteString(header)
+	for _, cmd := range commands {
+		if cmd.permission != level {
+			continue
+		}
+		help.WriteString(fmt.Sprintf("\n%s - %s", cmd.usage(), cmd.description))
+		if len(cmd.aliases) > 0 {
+			help.WriteString(fmt.Sprintf(" (also !%s)", strings.Join(cmd.aliases, ", !")))
+		}
+	}
+	return help.String()
+}
+
+func handleHelp(c *commandContext) {
+	c.reply(helpText("Available commands:", permissionEveryone) + `
+
+Characters can also be given as Name-Realm or as a link to their armory page. Put realms with spaces in quotes, e.g. "Area 52".
+Most commands are also available as slash commands, e.g. /register.`)
+}
+
+func handleAdminHelp(c *commandContext) {
+	c.reply(helpText("Available admin commands (DM only):", permissionAdmin))
+}
@@ -0,0 +1,228 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// departurePurgeInterval is how often registrations past the grace period are deleted
+const departurePurgeInterval = time.Hour
+
+// Audit log events
+const (
+	auditLeft     = "left"
+	auditRejoined = "rejoined"
+	auditPurged   = "purged"
+)
+
+// handleMemberLeave marks the registration of a member who left the Discord server as
+// departed. It is deleted once DEPARTED_GRACE_PERIOD has passed, or by an admin.
+func handleMemberLeave(s DiscordSession, m *discordgo.GuildMemberRemove) {
+	if m.Member == nil || m.User == nil || m.User.Bot {
+		return
+	}
+	if cfg.DiscordGuildID != "" && m.GuildID != cfg.DiscordGuildID {
+		return
+	}
+
+	reg, err := memberRegistration(m.User)
+	if err != nil {
+		util.Logger.Printf("Error getting registration of departed member %s: %v", m.User.Username, err)
+		return
+	}
+	if reg == nil {
+		return
+	}
+
+	if err := database.MarkRegistrationLeft(db, reg.DiscordUsername, time.Now()); err != nil {
+		util.Logger.Printf("Error marking registration of %s as departed: %v", reg.DiscordUsername, err)
+		return
+	}
+	util.Logger.Printf("Registered member %s (%s on %s) left the server", reg.DiscordUsername, reg.CharacterName, reg.Server)
+	recordAudit(auditLeft, reg, m.User.ID, "")
+}
+
+// markRejoined clears the departure of a registered member who joined the server again
+func markRejoined(reg *database.CharacterRegistration, userID string) {
+	if reg.LeftAt.IsZero() {
+		return
+	}
+	if err := database.MarkRegistrationActive(db, reg.DiscordUsername); err != nil {
+		util.Logger.Printf("Error marking registration of %s as active: %v", reg.DiscordUsername, err)
+		return
+	}
+	recordAudit(auditRejoined, reg, userID, fmt.Sprintf("left %s", formatDate(reg.LeftAt)))
+	reg.LeftAt = time.Time{}
+}
+
+// recordAudit adds a membership event for a registration to the audit log
+func recordAudit(event string, reg *database.CharacterRegistration, userID, details string) {
+	if userID == "" {
+		userID = reg.DiscordUserID
+	}
+	description := fmt.Sprintf("%s on %s", reg.CharacterName, reg.Server)
+	if details != "" {
+		description += ", " + details
+	}
+	err := database.AddAuditEntry(db, database.AuditEntry{
+		Event:           event,
+		DiscordUsername: reg.DiscordUsername,
+		DiscordUserID:   userID,
+		Details:         description,
+	})
+	if err != nil {
+		util.Logger.Printf("Error recording %s event of %s: %v", event, reg.DiscordUsername, err)
+	}
+}
+
+// purgeDeparted deletes the registrations of users who left the server before the
+// given time and returns them. reason is recorded in the audit log. Users who rejoin
+// while the purge runs keep their registration.
+func purgeDeparted(leftBefore time.Time, reason string) ([]database.CharacterRegistration, error) {
+	departed, err := database.GetDepartedRegistrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get departed registrations: %w", err)
+	}
+
+	var purged []database.CharacterRegistration
+	for _, reg := range departed {
+		if !reg.LeftAt.Before(leftBefore) {
+			continue
+		}
+		deleted, err := database.PurgeDepartedRegistration(db, reg.DiscordUsername, leftBefore)
+		if err != nil {
+			return purged, fmt.Errorf("failed to remove registration of %s: %w", reg.DiscordUsername, err)
+		}
+		if !deleted {
+			continue
+		}
+		recordAudit(auditPurged, &reg, "", reason)
+		purged = append(purged, reg)
+	}
+	return purged, nil
+}
+
+// startDeparturePurger deletes registrations whose users left more than
+// DepartedGracePeriod ago, until the context is cancelled. Without a grace period
+// departed registrations are kept until an admin purges them.
+func startDeparturePurger(ctx context.Context) {
+	if cfg.DepartedGracePeriod <= 0 {
+		util.Logger.Print("Automatic purging of departed registrations is disabled")
+		return
+	}
+	util.Logger.Printf("Purging registrations %v after their users leave", cfg.DepartedGracePeriod)
+
+	purge := func() {
+		purged, err := purgeDeparted(time.Now().Add(-cfg.DepartedGracePeriod), "grace period expired")
+		if err != nil {
+			util.Logger.Printf("Error purging departed registrations: %v", err)
+		}
+		for _, reg := range purged {
+			util.Logger.Printf("Purged registration of departed user %s (%s on %s)", reg.DiscordUsername, reg.CharacterName, reg.Server)
+		}
+	}
+
+	if !startHandler() {
+		return
+	}
+	go func() {
+		defer handlers.Done()
+		purge()
+		ticker := time.NewTicker(departurePurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
+
+func handleDeparted(c *commandContext) {
+	departed, err := database.GetDepartedRegistrations(db)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error getting departed users: %v", err))
+		return
+	}
+	if len(departed) == 0 {
+		c.reply("No registered users have left the server")
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString("Registered users who left the server:")
+	for i, reg := range departed {
+		line := fmt.Sprintf("\n- %s: %s on %s, left %s", reg.DiscordUsername, reg.CharacterName, reg.Server, formatDate(reg.LeftAt))
+		if cfg.DepartedGracePeriod > 0 {
+			line += fmt.Sprintf(", purged after %s", formatDate(reg.LeftAt.Add(cfg.DepartedGracePeriod)))
+		}
+		more := fmt.Sprintf("\n...and %d more", len(departed)-i)
+		if response.Len()+len(line)+len(more) > maxMessageLength {
+			response.WriteString(more)
+			break
+		}
+		response.WriteString(line)
+	}
+	c.reply(response.String())
+}
+
+func handlePurgeDeparted(c *commandContext) {
+	reason := fmt.Sprintf("purged by %s", c.user.Username)
+
+	username := c.params["discord_username"]
+	if username == "" {
+		purged, err := purgeDeparted(time.Now(), reason)
+		if err != nil {
+			c.reply(fmt.Sprintf("Error purging departed users (%d purged): %v", len(purged), err))
+			return
+		}
+		if len(purged) == 0 {
+			c.reply("No registered users have left the server")
+			return
+		}
+		var names []string
+		for _, reg := range purged {
+			names = append(names, reg.DiscordUsername)
+		}
+		c.reply(fmt.Sprintf("Purged the registrations of departed users: %s", strings.Join(names, ", ")))
+		return
+	}
+
+	reg, err := database.GetCharacter(db, username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply(fmt.Sprintf("No registration found for %s", username))
+		return
+	}
+	deleted := false
+	if !reg.LeftAt.IsZero() {
+		deleted, err = database.PurgeDepartedRegistration(db, username, time.Now())
+		if err != nil {
+			c.reply(fmt.Sprintf("Error removing registration: %v", err))
+			return
+		}
+	}
+	if !deleted {
+		c.reply(fmt.Sprintf("%s has not left the server, use !remove-user to remove their registration", username))
+		return
+	}
+	recordAudit(auditPurged, reg, "", reason)
+	c.reply(fmt.Sprintf("Purged the registration of %s (%s on %s)", username, reg.CharacterName, reg.Server))
+}
+
+// formatDate formats a time as a UTC date, e.g. 2024-05-01
+func formatDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bezerker/sndbot/blizzard"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultEmbedColor is used when a character's class is unknown
+const defaultEmbedColor = 0x148EFF
+
+// classColors are the in-game class colours, keyed by playable class ID
+var classColors = map[int]int{
+	1:  0xC69B6D, // Warrior
+	2:  0xF48CBA, // Paladin
+	3:  0xAAD372, // Hunter
+	4:  0xFFF468, // Rogue
+	5:  0xFFFFFF, // Priest
+	6:  0xC41E3A, // Death Knight
+	7:  0x0070DD, // Shaman
+	8:  0x3FC7EB, // Mage
+	9:  0x8788EE, // Warlock
+	10: 0x00FF98, // Monk
+	11: 0xFF7C0A, // Druid
+	12: 0xA330C9, // Demon Hunter
+	13: 0x33937F, // Evoker
+}
+
+// characterCard is the Blizzard data shown in character embeds. Summary and media are
+// nil when they could not be loaded, in which case the embed shows what is known.
+type characterCard struct {
+	name    string
+	realm   string
+	summary *blizzard.CharacterSummary
+	media   *blizzard.CharacterMedia
+}
+
+// loadCharacterCard fetches the profile summary and media of a character. Failures are
+// logged and leave the corresponding part of the card empty.
+func loadCharacterCard(ctx context.Context, characterName, realm string) *characterCard {
+	card := &characterCard{name: characterName, realm: realm}
+
+	summary, err := blizzardAPI.GetCharacterSummary(ctx, characterName, realm)
+	if err != nil {
+		util.Logger.Printf("Error getting character summary for embed: %v", err)
+		return card
+	}
+	card.summary = summary
+	card.name = summary.Name
+	if summary.Realm.Name != "" {
+		card.realm = summary.Realm.Name
+	}
+
+	media, err := blizzardAPI.GetCharacterMedia(ctx, characterName, realm)
+	if err != nil {
+		util.Logger.Printf("Error getting character media for embed: %v", err)
+		return card
+	}
+	card.media = media
+	return card
+}
+
+// embed returns the character embed with name, realm, level, class, race, faction and
+// guild, coloured by class and with the character's avatar as thumbnail
+func (card *characterCard) embed() *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("%s - %s", card.name, card.realm),
+		Color: defaultEmbedColor,
+	}
+	if card.media != nil {
+		if avatar := card.media.Asset(blizzard.MediaAvatar); avatar != "" {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: avatar}
+		}
+	}
+
+	summary := card.summary
+	if summary == nil {
+		return embed
+	}
+	if color, ok := classColors[summary.CharacterClass.ID]; ok {
+		embed.Color = color
+	}
+
+	class := summary.CharacterClass.Name
+	if summary.ActiveSpec.Name != "" {
+		class = strings.TrimSpace(summary.ActiveSpec.Name + " " + class)
+	}
+	if summary.Level > 0 {
+		addEmbedField(embed, "Level", fmt.Sprintf("%d", summary.Level))
+	}
+	addEmbedField(embed, "Class", class)
+	addEmbedField(embed, "Race", summary.Race.Name)
+	addEmbedField(embed, "Faction", summary.Faction.Name)
+	addEmbedField(embed, "Guild", summary.Guild.Name)
+	return embed
+}
+
+// addEmbedField adds an inline field, skipping empty values
+func addEmbedField(embed *discordgo.MessageEmbed, name, value string) {
+	if value == "" {
+		return
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true})
+}
+
+// setEmbedField replaces the value of a field, adding it if it is missing
+func setEmbedField(embed *discordgo.MessageEmbed, name, value string) {
+	for _, field := range embed.Fields {
+		if field.Name == name {
+			field.Value = value
+			return
+		}
+	}
+	addEmbedField(embed, name, value)
+}
+
+// whoamiEmbed describes the caller's registered character
+func whoamiEmbed(card *characterCard) *discordgo.MessageEmbed {
+	embed := card.embed()
+	embed.Description = "Your registered character"
+	return embed
+}
+
+// guildEmbed describes a character's guild membership
+func guildEmbed(card *characterCard, guildInfo *blizzard.GuildInfo, rank string) *discordgo.MessageEmbed {
+	embed := card.embed()
+	setEmbedField(embed, "Guild", guildInfo.Name)
+	setEmbedField(embed, "Faction", guildInfo.Faction)
+	addEmbedField(embed, "Rank", rank)
+	return embed
+}
+
+// checkGuildEmbed describes whether a character is in the tracked guild
+func checkGuildEmbed(card *characterCard, description string) *discordgo.MessageEmbed {
+	embed := card.embed()
+	embed.Description = description
+	return embed
+}
+
+// embedsAllowed reports whether the bot may post embeds in a channel. Channels missing
+// from the state cache, such as DMs, are assumed to allow them.
+func embedsAllowed(s DiscordSession, channelID string) bool {
+	state := s.GetState()
+	if state == nil || state.User == nil {
+		return true
+	}
+	perms, err := state.UserChannelPermissions(state.User.ID, channelID)
+	if err != nil {
+		return true
+	}
+	return perms&discordgo.PermissionEmbedLinks != 0
+}
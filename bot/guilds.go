@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bezerker/sndbot/blizzard"
+	config "github.com/bezerker/sndbot/config"
+)
+
+// trackedGuildOf returns the tracked guild a character belongs to, or nil if the
+// character is not in a guild or in a guild that is not tracked
+func trackedGuildOf(ctx context.Context, characterName, realm string) (*config.TrackedGuild, *blizzard.Guild, error) {
+	guild, err := blizzardAPI.GetCharacterGuild(ctx, characterName, realm)
+	if err != nil || guild == nil {
+		return nil, nil, err
+	}
+	return matchTrackedGuild(guild), guild, nil
+}
+
+// matchTrackedGuild returns the tracked guild matching a guild from the Blizzard API, by
+// ID when the tracked guild has one and by name and realm otherwise
+func matchTrackedGuild(guild *blizzard.Guild) *config.TrackedGuild {
+	guilds := cfg.Guilds()
+	for i := range guilds {
+		tracked := &guilds[i]
+		if tracked.ID != 0 {
+			if tracked.ID == guild.ID {
+				return tracked
+			}
+			continue
+		}
+		realm := blizzard.RealmKey(tracked.Realm)
+		if strings.EqualFold(tracked.Name, guild.Name) && (realm == blizzard.RealmKey(guild.Realm.Slug) || realm == blizzard.RealmKey(guild.Realm.Name)) {
+			return tracked
+		}
+	}
+	return nil
+}
+
+// trackedGuildNames lists the names of the tracked guilds for messages
+func trackedGuildNames() string {
+	var names []string
+	for _, guild := range cfg.Guilds() {
+		names = append(names, guild.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// rankRoleIDs returns every distinct role ID of a guild's rank mapping
+func rankRoleIDs(guild *config.TrackedGuild) []string {
+	var roles []string
+	seen := make(map[string]bool)
+	for _, role := range guild.RankRoleIDs {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// guildRoleIDs returns the member and rank roles of a guild
+func guildRoleIDs(guild *config.TrackedGuild) []string {
+	return append(append([]string{}, guild.MemberRoleIDs...), rankRoleIDs(guild)...)
+}
+
+// guildsUseRanks reports whether any tracked guild maps ranks to roles
+func guildsUseRanks() bool {
+	for _, guild := range cfg.Guilds() {
+		if len(guild.RankRoleIDs) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandContext carries a command invocation, whether it arrived as a chat message
+// or as a slash command. args[0] is the command name in its "!name" form.
+type commandContext struct {
+	ctx       context.Context
+	session   DiscordSession
+	channelID string
+	user      *discordgo.User
+	args      []string
+	reply     func(content string)
+	// replyEmbed sends an embed, or the fallback text where embeds cannot be posted
+	replyEmbed func(embed *discordgo.MessageEmbed, fallback string)
+	// replyComplex sends a message with components or attached files
+	replyComplex func(msg *discordgo.MessageSend)
+	// command and params are set once the arguments have been parsed
+	command *command
+	params  map[string]string
+}
+
+// newMessageCommandContext returns the context for a command sent as a chat message
+func newMessageCommandContext(s DiscordSession, m *discordgo.MessageCreate, args []string) *commandContext {
+	return &commandContext{
+		ctx:       botCtx,
+		session:   s,
+		channelID: m.ChannelID,
+		user:      m.Author,
+		args:      args,
+		reply: func(content string) {
+			s.ChannelMessageSend(m.ChannelID, content)
+		},
+		replyEmbed: func(embed *discordgo.MessageEmbed, fallback string) {
+			if embedsAllowed(s, m.ChannelID) {
+				_, err := s.ChannelMessageSendEmbed(m.ChannelID, embed)
+				if err == nil {
+					return
+				}
+				util.Logger.Printf("Error sending embed, falling back to text: %v", err)
+			}
+			s.ChannelMessageSend(m.ChannelID, fallback)
+		},
+		replyComplex: func(msg *discordgo.MessageSend) {
+			if _, err := s.ChannelMessageSendComplex(m.ChannelID, msg); err != nil {
+				util.Logger.Printf("Error sending message: %v", err)
+			}
+		},
+	}
+}
+
+// slashCommandOptions converts a command's argument schema to slash command options.
+// Character arguments become a character option and an optional realm option, flags
+// become boolean options and usernames become user options.
+func slashCommandOptions(cmd *command) []*discordgo.ApplicationCommandOption {
+	var options []*discordgo.ApplicationCommandOption
+	for _, arg := range cmd.args {
+		option := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        arg.name,
+			Description: arg.description,
+			Required:    arg.required,
+		}
+		switch arg.kind {
+		case argFlag:
+			option.Type = discordgo.ApplicationCommandOptionBoolean
+		case argUser:
+			option.Type = discordgo.ApplicationCommandOptionUser
+		}
+		for _, choice := range arg.choices {
+			option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+		}
+		options = append(options, option)
+		if arg.kind == argCharacter {
+			options = append(options, &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "realm",
+				Description: "Realm, if not part of the character",
+			})
+		}
+	}
+	return options
+}
+
+// slashCommands returns the application command definitions for every command. Admin
+// commands are hidden from members without server permissions, and only commands
+// that may be used in DMs are offered there.
+func slashCommands() []*discordgo.ApplicationCommand {
+	var definitions []*discordgo.ApplicationCommand
+	for _, cmd := range commands {
+		definition := &discordgo.ApplicationCommand{
+			Name:         cmd.name,
+			Description:  cmd.description,
+			Options:      slashCommandOptions(cmd),
+			DMPermission: boolPtr(cmd.scope != scopeGuild),
+		}
+		if cmd.permission == permissionAdmin {
+			var adminOnly int64
+			definition.DefaultMemberPermissions = &adminOnly
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// registerSlashCommands replaces the bot's application commands with one per command
+func registerSlashCommands(s DiscordSession, appID string) error {
+	registered, err := s.ApplicationCommandBulkOverwrite(appID, "", slashCommands())
+	if err != nil {
+		return fmt.Errorf("failed to register slash commands: %w", err)
+	}
+	util.Logger.Printf("Registered %d slash commands", len(registered))
+	return nil
+}
+
+// slashCommandArgs converts the options of a slash command to chat command arguments,
+// in the order of the command's argument schema
+func slashCommandArgs(cmd *command, data discordgo.ApplicationCommandInteractionData) []string {
+	args := []string{"!" + cmd.name}
+
+	provided := make(map[string]string, len(data.Options))
+	for _, option := range data.Options {
+		provided[option.Name] = fmt.Sprint(option.Value)
+	}
+
+	kinds := make(map[string]argumentKind, len(cmd.args))
+	for _, arg := range cmd.args {
+		kinds[arg.name] = arg.kind
+	}
+
+	for _, def := range slashCommandOptions(cmd) {
+		value, ok := provided[def.Name]
+		if !ok {
+			continue
+		}
+		switch kinds[def.Name] {
+		case argNamed:
+			args = append(args, def.Name+":"+value)
+		case argUser:
+			// User options hold the user's ID
+			if data.Resolved != nil && data.Resolved.Users[value] != nil {
+				value = data.Resolved.Users[value].Username
+			}
+			args = append(args, value)
+		case argFlag:
+			if value == "true" {
+				args = append(args, def.Name)
+			}
+		default:
+			args = append(args, value)
+		}
+	}
+	return args
+}
+
+// newInteraction handles slash commands and button presses. Commands that call the
+// Blizzard API are acknowledged with a deferred response first, since Discord expects
+// an answer within three seconds; their replies are then sent as follow-up messages.
+func newInteraction(s DiscordSession, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+	case discordgo.InteractionMessageComponent:
+		handleComponent(s, i)
+		return
+	default:
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	cmd := lookupCommand("!" + data.Name)
+	c := newInteractionCommandContext(s, i, cmd, data)
+	if cmd == nil {
+		c.reply("Unknown command")
+		return
+	}
+
+	if cmd.timeout > 0 {
+		c.deferReply()
+	}
+	dispatch(c.commandContext, cmd, true)
+}
+
+// interactionReplier answers an interaction, switching to follow-up messages once
+// the interaction has been responded to
+type interactionReplier struct {
+	session     DiscordSession
+	interaction *discordgo.Interaction
+	flags       discordgo.MessageFlags
+	replied     bool
+}
+
+func (r *interactionReplier) deferReply() {
+	err := r.session.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: r.flags},
+	})
+	if err != nil {
+		util.Logger.Printf("Error deferring interaction response: %v", err)
+		return
+	}
+	r.replied = true
+}
+
+func (r *interactionReplier) reply(content string) {
+	r.send(&discordgo.MessageSend{Content: content})
+}
+
+// replyEmbed sends an embed; interaction responses can always carry embeds, so the
+// fallback text is only used if sending the embed fails
+func (r *interactionReplier) replyEmbed(embed *discordgo.MessageEmbed, fallback string) {
+	if err := r.send(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}); err != nil {
+		r.send(&discordgo.MessageSend{Content: fallback})
+	}
+}
+
+func (r *interactionReplier) replyComplex(msg *discordgo.MessageSend) {
+	r.send(msg)
+}
+
+func (r *interactionReplier) send(msg *discordgo.MessageSend) error {
+	if !r.replied {
+		err := r.session.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:    msg.Content,
+				Embeds:     msg.Embeds,
+				Components: msg.Components,
+				Files:      msg.Files,
+				Flags:      r.flags,
+			},
+		})
+		if err != nil {
+			util.Logger.Printf("Error responding to interaction: %v", err)
+			return err
+		}
+		r.replied = true
+		return nil
+	}
+
+	_, err := r.session.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{
+		Content:    msg.Content,
+		Embeds:     msg.Embeds,
+		Components: msg.Components,
+		Files:      msg.Files,
+		Flags:      r.flags,
+	})
+	if err != nil {
+		util.Logger.Printf("Error sending follow-up message: %v", err)
+	}
+	return err
+}
+
+// interactionCommandContext is a commandContext answering through an interaction
+type interactionCommandContext struct {
+	*commandContext
+	replier *interactionReplier
+}
+
+func (c *interactionCommandContext) deferReply() {
+	c.replier.deferReply()
+}
+
+// interactionUser returns the user who triggered an interaction, in a server or a DM
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// newInteractionCommandContext returns the context for a slash command. Replies to
+// admin commands are only visible to the admin.
+func newInteractionCommandContext(s DiscordSession, i *discordgo.InteractionCreate, cmd *command, data discordgo.ApplicationCommandInteractionData) *interactionCommandContext {
+	user := interactionUser(i)
+
+	replier := &interactionReplier{session: s, interaction: i.Interaction}
+	var args []string
+	if cmd != nil {
+		args = slashCommandArgs(cmd, data)
+		if cmd.permission == permissionAdmin {
+			replier.flags = discordgo.MessageFlagsEphemeral
+		}
+	}
+
+	return &interactionCommandContext{
+		commandContext: &commandContext{
+			ctx:          botCtx,
+			session:      s,
+			channelID:    i.ChannelID,
+			user:         user,
+			args:         args,
+			reply:        replier.reply,
+			replyEmbed:   replier.replyEmbed,
+			replyComplex: replier.replyComplex,
+		},
+		replier: replier,
+	}
+}
+
+// handleComponent routes button presses to the command that created the buttons. Custom
+// IDs start with the command name, e.g. "list-users:<session>:<page>".
+func handleComponent(s DiscordSession, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	name, _, _ := strings.Cut(data.CustomID, ":")
+	switch name {
+	case "list-users":
+		handleListUsersPage(s, i, data.CustomID)
+	default:
+		util.Logger.Printf("Unknown component interaction: %s", data.CustomID)
+	}
+}
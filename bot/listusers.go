@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bezerker/sndbot/blizzard"
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// listUsersPageSize is the most registrations shown on one page
+	listUsersPageSize = 20
+	// listUsersPageLength keeps pages well below Discord's 2000 character message limit
+	listUsersPageLength = 1900
+	// listUsersSessionTTL is how long the page buttons of a listing keep working
+	listUsersSessionTTL = 15 * time.Minute
+)
+
+// listUsersArgs are the filters, sort order and CSV flag of !list-users
+var listUsersArgs = []argument{
+	{name: "realm", description: "Only show characters on this realm", kind: argNamed},
+	{name: "guild", description: "Only show characters that are (yes) or are not (no) in a tracked guild", kind: argNamed, choices: []string{"yes", "no"}},
+	{name: "prefix", description: "Only show characters or Discord users starting with this text", kind: argNamed},
+	{name: "sort", description: "Sort by Discord user (default), character or realm", kind: argNamed, choices: []string{"user", "character", "realm"}},
+	{name: "csv", description: "Send the full list as a CSV file", kind: argFlag},
+}
+
+// listUsersSession holds the pages of a listing so that its buttons can page through
+// it without querying the database again
+type listUsersSession struct {
+	owner   string
+	pages   []string
+	expires time.Time
+}
+
+var (
+	listUsersSessionsMu sync.Mutex
+	listUsersSessions   = make(map[string]*listUsersSession)
+	listUsersSessionSeq int
+)
+
+func handleListUsers(c *commandContext) {
+	registrations, err := database.GetAllRegistrations(db)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error getting registrations: %v", err))
+		return
+	}
+	if len(registrations) == 0 {
+		c.reply("No registered users found")
+		return
+	}
+
+	registrations, err = filterRegistrations(c, registrations)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error checking guild membership: %s", describeBlizzardError(err)))
+		return
+	}
+	if len(registrations) == 0 {
+		c.reply("No registered users match the filters")
+		return
+	}
+	sortRegistrations(registrations, c.params["sort"])
+
+	if c.params["csv"] == "true" {
+		data, err := registrationsCSV(registrations)
+		if err != nil {
+			c.reply(fmt.Sprintf("Error building CSV: %v", err))
+			return
+		}
+		c.replyComplex(&discordgo.MessageSend{
+			Content: fmt.Sprintf("Registered users: %d", len(registrations)),
+			Files: []*discordgo.File{{
+				Name:        "registrations.csv",
+				ContentType: "text/csv",
+				Reader:      bytes.NewReader(data),
+			}},
+		})
+		return
+	}
+
+	pages := paginateRegistrations(registrations)
+	if len(pages) == 1 {
+		c.reply(pages[0])
+		return
+	}
+	sessionID := newListUsersSession(c.user.ID, pages)
+	c.replyComplex(&discordgo.MessageSend{
+		Content:    pages[0],
+		Components: listUsersButtons(sessionID, 0, len(pages)),
+	})
+}
+
+// filterRegistrations applies the realm, prefix and guild filters. The guild roster is
+// only fetched when filtering by guild membership.
+func filterRegistrations(c *commandContext, registrations []database.CharacterRegistration) ([]database.CharacterRegistration, error) {
+	realm := blizzard.RealmKey(c.params["realm"])
+	prefix := strings.ToLower(c.params["prefix"])
+
+	var inGuild map[string]bool
+	if c.params["guild"] != "" {
+		inGuild = make(map[string]bool)
+		for _, guild := range cfg.Guilds() {
+			roster, err := blizzardAPI.GetGuildRoster(c.ctx, guild.Realm, blizzard.GuildSlug(guild.Name))
+			if err != nil {
+				return nil, err
+			}
+			for _, member := range roster.Members {
+				inGuild[registrationKey(member.Character.Name, member.Character.Realm.Slug)] = true
+			}
+		}
+	}
+
+	var filtered []database.CharacterRegistration
+	for _, reg := range registrations {
+		if realm != "" && blizzard.RealmKey(reg.Server) != realm {
+			continue
+		}
+		if prefix != "" && !strings.HasPrefix(strings.ToLower(reg.CharacterName), prefix) &&
+			!strings.HasPrefix(strings.ToLower(reg.DiscordUsername), prefix) {
+			continue
+		}
+		if inGuild != nil && inGuild[registrationKey(reg.CharacterName, reg.Server)] != (c.params["guild"] == "yes") {
+			continue
+		}
+		filtered = append(filtered, reg)
+	}
+	return filtered, nil
+}
+
+// registrationKey identifies a character independently of how its realm was written
+func registrationKey(characterName, realm string) string {
+	return strings.ToLower(characterName) + "-" + blizzard.RealmKey(realm)
+}
+
+// sortRegistrations orders registrations by Discord user, character or realm. Ties are
+// broken by Discord user so that the order is stable between listings.
+func sortRegistrations(registrations []database.CharacterRegistration, by string) {
+	key := func(reg database.CharacterRegistration) string {
+		switch by {
+		case "character":
+			return strings.ToLower(reg.CharacterName)
+		case "realm":
+			return blizzard.RealmKey(reg.Server)
+		default:
+			return strings.ToLower(reg.DiscordUsername)
+		}
+	}
+	sort.SliceStable(registrations, func(i, j int) bool {
+		a, b := key(registrations[i]), key(registrations[j])
+		if a != b {
+			return a < b
+		}
+		return strings.ToLower(registrations[i].DiscordUsername) < strings.ToLower(registrations[j].DiscordUsername)
+	})
+}
+
+// paginateRegistrations splits the listing into pages of at most listUsersPageSize
+// entries that fit in a single message
+func paginateRegistrations(registrations []database.CharacterRegistration) []string {
+	var chunks [][]string
+	var current []string
+	length := 0
+	for _, reg := range registrations {
+		line := fmt.Sprintf("- %s: %s on %s\n", reg.DiscordUsername, reg.CharacterName, reg.Server)
+		if len(current) == listUsersPageSize || (len(current) > 0 && length+len(line) > listUsersPageLength) {
+			chunks = append(chunks, current)
+			current, length = nil, 0
+		}
+		current = append(current, line)
+		length += len(line)
+	}
+	chunks = append(chunks, current)
+
+	if len(chunks) == 1 {
+		return []string{"Registered users:\n" + strings.Join(chunks[0], "")}
+	}
+	pages := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		pages[i] = fmt.Sprintf("Registered users (page %d/%d, %d total):\n%s", i+1, len(chunks), len(registrations), strings.Join(chunk, ""))
+	}
+	return pages
+}
+
+// registrationsCSV renders the registrations as CSV with a header row
+func registrationsCSV(registrations []database.CharacterRegistration) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"discord_username", "character_name", "realm"})
+	for _, reg := range registrations {
+		w.Write([]string{reg.DiscordUsername, reg.CharacterName, reg.Server})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// newListUsersSession stores the pages of a listing and returns its ID. Expired
+// sessions are dropped at the same time.
+func newListUsersSession(owner string, pages []string) string {
+	listUsersSessionsMu.Lock()
+	defer listUsersSessionsMu.Unlock()
+
+	now := time.Now()
+	for id, session := range listUsersSessions {
+		if now.After(session.expires) {
+			delete(listUsersSessions, id)
+		}
+	}
+
+	listUsersSessionSeq++
+	id := strconv.Itoa(listUsersSessionSeq)
+	listUsersSessions[id] = &listUsersSession{owner: owner, pages: pages, expires: now.Add(listUsersSessionTTL)}
+	return id
+}
+
+// listUsersButtons returns the previous and next buttons for a page of a listing
+func listUsersButtons(sessionID string, page, pageCount int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("list-users:%s:%d", sessionID, page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("list-users:%s:%d", sessionID, page+1),
+				Disabled: page == pageCount-1,
+			},
+		}},
+	}
+}
+
+// handleListUsersPage answers a press of a listing's previous or next button by
+// replacing the message with the requested page
+func handleListUsersPage(s DiscordSession, i *discordgo.InteractionCreate, customID string) {
+	parts := strings.Split(customID, ":")
+	if len(parts) != 3 {
+		return
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return
+	}
+
+	listUsersSessionsMu.Lock()
+	session := listUsersSessions[parts[1]]
+	listUsersSessionsMu.Unlock()
+
+	var notice string
+	switch {
+	case session == nil || time.Now().After(session.expires):
+		notice = "This list has expired, please run !list-users again."
+	case interactionUser(i) == nil || interactionUser(i).ID != session.owner:
+		notice = "Only the admin who ran !list-users can page through this list."
+	}
+	if notice != "" {
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: notice, Flags: discordgo.MessageFlagsEphemeral},
+		})
+	} else {
+		page = max(0, min(page, len(session.pages)-1))
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    session.pages[page],
+				Components: listUsersButtons(parts[1], page, len(session.pages)),
+			},
+		})
+	}
+	if err != nil {
+		util.Logger.Printf("Error responding to list-users button: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxNicknameLength is Discord's limit on server nicknames
+const maxNicknameLength = 32
+
+// errNicknameNotPermitted is returned when Discord refuses to change a nickname, as it
+// does for the server owner and for members with a role above the bot's
+var errNicknameNotPermitted = errors.New("the bot is not allowed to change this member's nickname")
+
+// characterNickname returns the nickname for a registered character, e.g. "Testchar" or
+// "Testchar-Area52" when NicknameIncludeRealm is set, shortened to Discord's limit
+func characterNickname(characterName, realm string) string {
+	nickname := capitalize(strings.ToLower(characterName))
+	if cfg.NicknameIncludeRealm {
+		// Written the way the game shows players from other realms
+		var compact strings.Builder
+		for _, word := range strings.FieldsFunc(realm, func(r rune) bool { return r == ' ' || r == '-' }) {
+			compact.WriteString(capitalize(word))
+		}
+		nickname += "-" + compact.String()
+	}
+	for utf8.RuneCountInString(nickname) > maxNicknameLength {
+		_, size := utf8.DecodeLastRuneInString(nickname)
+		nickname = nickname[:len(nickname)-size]
+	}
+	return nickname
+}
+
+// capitalize upper-cases the first letter of a word
+func capitalize(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	if first == utf8.RuneError {
+		return word
+	}
+	return string(unicode.ToUpper(first)) + word[size:]
+}
+
+// syncNickname sets a member's server nickname to their registered character when
+// SyncNicknames is enabled. It returns the new nickname, or "" when nothing changed.
+// errNicknameNotPermitted is returned when Discord refuses the change.
+func syncNickname(s DiscordSession, guildID string, member *discordgo.Member, characterName, realm string) (string, error) {
+	if !cfg.SyncNicknames {
+		return "", nil
+	}
+	nickname := characterNickname(characterName, realm)
+	if member.Nick == nickname {
+		return "", nil
+	}
+
+	if util.IsDebugEnabled() {
+		util.Logger.Printf("Setting nickname of user %s to %s", member.User.Username, nickname)
+	}
+	err := s.GuildMemberNickname(guildID, member.User.ID, nickname)
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && (restErr.Response != nil && restErr.Response.StatusCode == http.StatusForbidden ||
+			restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeMissingPermissions) {
+			util.Logger.Printf("Not permitted to change the nickname of user %s: %v", member.User.Username, err)
+			return "", errNicknameNotPermitted
+		}
+		return "", fmt.Errorf("failed to set nickname: %v", err)
+	}
+	return nickname, nil
+}
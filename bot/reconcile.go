@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/bezerker/sndbot/config"
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// reconcileTimeout bounds a single reconciliation run
+const reconcileTimeout = 10 * time.Minute
+
+// maxMessageLength is Discord's limit on the content of a message
+const maxMessageLength = 2000
+
+// reconcileMu keeps the scheduled job and !reconcile from running at the same time
+var reconcileMu sync.Mutex
+
+// reconcileSummary collects the outcome of a reconciliation run, one line per
+// registration that changed, was skipped or failed
+type reconcileSummary struct {
+	checked int
+	changed []string
+	skipped []string
+	failed  []string
+}
+
+// String describes the run for the admin channel, within Discord's message limit
+func (r *reconcileSummary) String() string {
+	header := fmt.Sprintf("Role reconciliation checked %d registrations: %d changed, %d skipped, %d failed",
+		r.checked, len(r.changed), len(r.skipped), len(r.failed))
+
+	lines := append(append(append([]string{}, r.changed...), r.failed...), r.skipped...)
+	var msg strings.Builder
+	msg.WriteString(header)
+	for i, line := range lines {
+		more := fmt.Sprintf("\n...and %d more", len(lines)-i)
+		if msg.Len()+len(line)+1+len(more) > maxMessageLength {
+			msg.WriteString(more)
+			break
+		}
+		msg.WriteString("\n" + line)
+	}
+	return msg.String()
+}
+
+// reconcileRoles re-verifies every registration with the Blizzard API and adds or
+// removes Discord roles to match. It stops early if the context is cancelled.
+func reconcileRoles(ctx context.Context, s DiscordSession, guildID string) (*reconcileSummary, error) {
+	registrations, err := database.GetAllRegistrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registrations: %w", err)
+	}
+
+	summary := &reconcileSummary{}
+	for _, reg := range registrations {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		// Users who left the server have no roles to reconcile
+		if !reg.LeftAt.IsZero() {
+			continue
+		}
+		summary.checked++
+		reconcileRegistration(ctx, s, guildID, reg, summary)
+	}
+	return summary, nil
+}
+
+// reconcileRegistration brings one member's roles in line with their registered character
+func reconcileRegistration(ctx context.Context, s DiscordSession, guildID string, reg database.CharacterRegistration, summary *reconcileSummary) {
+	member := findRegisteredMember(s, guildID, reg)
+	if member == nil {
+		summary.skipped = append(summary.skipped, fmt.Sprintf("- %s: skipped, not found in the Discord server", reg.DiscordUsername))
+		return
+	}
+	fail := func(err error) {
+		summary.failed = append(summary.failed, fmt.Sprintf("- %s: failed, %s", reg.DiscordUsername, describeBlizzardError(err)))
+	}
+
+	exists, err := blizzardAPI.CharacterExists(ctx, reg.CharacterName, reg.Server)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var granted, removed []string
+	if !exists {
+		// The character was deleted, renamed or transferred
+		removed, err = revokeMemberRoles(s, guildID, member, nil, true)
+	} else {
+		var guild *config.TrackedGuild
+		guild, _, err = trackedGuildOf(ctx, reg.CharacterName, reg.Server)
+		if err != nil {
+			fail(err)
+			return
+		}
+		rank := -1
+		if guild != nil {
+			rank = guildRank(ctx, reg.CharacterName, reg.Server)
+		}
+		granted, removed, err = grantMemberRoles(s, guildID, member, guild, rank)
+		if err == nil {
+			// Drop the roles of guilds the character has left
+			var left []string
+			left, err = revokeMemberRoles(s, guildID, member, guild, false)
+			removed = append(removed, left...)
+		}
+
+		// Role rules go through the same grants and removals, once the guild roles are settled
+		if err == nil {
+			var facts *ruleFacts
+			facts, err = loadRuleFacts(ctx, reg.CharacterName, reg.Server, guild != nil, rank)
+			if facts != nil {
+				var ruleGranted, ruleRemoved []string
+				ruleGranted, ruleRemoved, err = applyRoleRules(s, guildID, member, facts)
+				granted = append(granted, ruleGranted...)
+				removed = append(removed, ruleRemoved...)
+			}
+		}
+	}
+
+	// Members the bot may not rename, such as the server owner, are left alone
+	var nickname string
+	if exists && err == nil {
+		nickname, err = syncNickname(s, guildID, member, reg.CharacterName, reg.Server)
+		if errors.Is(err, errNicknameNotPermitted) {
+			err = nil
+		}
+	}
+
+	if len(granted) > 0 || len(removed) > 0 || nickname != "" {
+		var changes []string
+		if len(granted) > 0 {
+			changes = append(changes, "granted "+strings.Join(granted, ", "))
+		}
+		if len(removed) > 0 {
+			changes = append(changes, "removed "+strings.Join(removed, ", "))
+		}
+		if nickname != "" {
+			changes = append(changes, "nickname set to "+nickname)
+		}
+		summary.changed = append(summary.changed, fmt.Sprintf("- %s (%s on %s): %s", reg.DiscordUsername, reg.CharacterName, reg.Server, strings.Join(changes, "; ")))
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// findRegisteredMember returns the Discord member of a registration, or nil if they are
+// not in the server. Registrations without a user ID are matched by username, and the
+// ID found is stored for later runs.
+func findRegisteredMember(s DiscordSession, guildID string, reg database.CharacterRegistration) *discordgo.Member {
+	if reg.DiscordUserID != "" {
+		member, err := s.GuildMember(guildID, reg.DiscordUserID)
+		if err != nil {
+			if util.IsDebugEnabled() {
+				util.Logger.Printf("Error getting member %s: %v", reg.DiscordUsername, err)
+			}
+			return nil
+		}
+		return member
+	}
+
+	members, err := s.GuildMembersSearch(guildID, reg.DiscordUsername, 1000)
+	if err != nil {
+		util.Logger.Printf("Error searching for member %s: %v", reg.DiscordUsername, err)
+		return nil
+	}
+	for _, member := range members {
+		if member.User != nil && member.User.Username == reg.DiscordUsername {
+			if err := database.SetDiscordUserID(db, reg.DiscordUsername, member.User.ID); err != nil {
+				util.Logger.Printf("Error storing Discord user ID of %s: %v", reg.DiscordUsername, err)
+			}
+			return member
+		}
+	}
+	return nil
+}
+
+// runReconciliation runs one reconciliation and posts the summary to the admin channel
+// when roles changed or checks failed
+func runReconciliation(ctx context.Context, s DiscordSession) {
+	if !reconcileMu.TryLock() {
+		util.Logger.Printf("Skipping role reconciliation, a previous run is still in progress")
+		return
+	}
+	defer reconcileMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout)
+	defer cancel()
+
+	summary, err := reconcileRoles(ctx, s, cfg.DiscordGuildID)
+	if err != nil {
+		util.Logger.Printf("Role reconciliation stopped: %v", err)
+		if summary == nil {
+			return
+		}
+	}
+	util.Logger.Print(summary.String())
+
+	if cfg.AdminChannelID == "" || (len(summary.changed) == 0 && len(summary.failed) == 0) {
+		return
+	}
+	if _, err := s.ChannelMessageSend(cfg.AdminChannelID, summary.String()); err != nil {
+		util.Logger.Printf("Error posting reconciliation summary: %v", err)
+	}
+}
+
+// startReconciler runs role reconciliation every ReconcileInterval until the context is
+// cancelled. It does nothing unless both the interval and the Discord server are configured.
+func startReconciler(ctx context.Context, s DiscordSession) {
+	if cfg.ReconcileInterval <= 0 || cfg.DiscordGuildID == "" {
+		util.Logger.Print("Periodic role reconciliation is disabled")
+		return
+	}
+	util.Logger.Printf("Reconciling roles every %v", cfg.ReconcileInterval)
+
+	if !startHandler() {
+		return
+	}
+	go func() {
+		defer handlers.Done()
+		ticker := time.NewTicker(cfg.ReconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runReconciliation(ctx, s)
+			}
+		}
+	}()
+}
+
+func handleReconcile(c *commandContext) {
+	if cfg.DiscordGuildID == "" {
+		c.reply("Role reconciliation needs DISCORD_GUILD_ID to be configured")
+		return
+	}
+	if !reconcileMu.TryLock() {
+		c.reply("A role reconciliation is already running, please try again later")
+		return
+	}
+	defer reconcileMu.Unlock()
+
+	summary, err := reconcileRoles(c.ctx, c.session, cfg.DiscordGuildID)
+	if err != nil {
+		if summary == nil {
+			c.reply(fmt.Sprintf("Role reconciliation failed: %v", err))
+			return
+		}
+		c.reply(fmt.Sprintf("Role reconciliation stopped early: %s\n%s", describeBlizzardError(err), summary))
+		return
+	}
+	c.reply(summary.String())
+}
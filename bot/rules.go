@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bezerker/sndbot/blizzard"
+	config "github.com/bezerker/sndbot/config"
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// ruleFacts is the character data role rules are evaluated against. Only the data used
+// by the configured rules is loaded.
+type ruleFacts struct {
+	level        int
+	faction      string
+	classID      int
+	class        string
+	rating       float64
+	achievements *blizzard.CharacterAchievements
+	inGuild      bool
+	rank         int
+}
+
+// rulesUse reports whether any configured rule has a condition matching the predicate
+func rulesUse(uses func(rule config.RoleRule) bool) bool {
+	for _, rule := range cfg.RoleRules {
+		if uses(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRoleRules checks that the class names of the role rules are known playable
+// classes, as a misspelled class would silently never match
+func validateRoleRules(rules []config.RoleRule) error {
+	for _, rule := range rules {
+		for _, class := range rule.Classes {
+			if _, ok := blizzard.ClassID(class); !ok {
+				return fmt.Errorf("rule %s: unknown class %q", rule.Name, class)
+			}
+		}
+	}
+	return nil
+}
+
+// loadRuleFacts fetches the character data needed by the configured role rules. It
+// returns nil when no rules are configured. Errors are returned rather than treated as
+// unmet conditions, so that a failing API call never revokes roles.
+func loadRuleFacts(ctx context.Context, characterName, realm string, isInGuild bool, rank int) (*ruleFacts, error) {
+	if len(cfg.RoleRules) == 0 {
+		return nil, nil
+	}
+	facts := &ruleFacts{inGuild: isInGuild, rank: rank}
+
+	if rulesUse(func(r config.RoleRule) bool { return r.MinLevel > 0 || r.Faction != "" || len(r.Classes) > 0 }) {
+		summary, err := blizzardAPI.GetCharacterSummary(ctx, characterName, realm)
+		if err != nil {
+			return nil, err
+		}
+		facts.level = summary.Level
+		facts.faction = summary.Faction.Type
+		facts.classID = summary.CharacterClass.ID
+		facts.class = summary.CharacterClass.Name
+	}
+
+	if rulesUse(func(r config.RoleRule) bool { return r.MinMythicRating > 0 }) {
+		profile, err := blizzardAPI.GetMythicKeystoneProfile(ctx, characterName, realm)
+		if err != nil {
+			return nil, err
+		}
+		// The rating is 0 for characters who have not played the current season, so
+		// ratings of earlier seasons never match
+		facts.rating = profile.CurrentRating
+	}
+
+	if rulesUse(func(r config.RoleRule) bool { return len(r.Achievements) > 0 }) {
+		achievements, err := blizzardAPI.GetCharacterAchievements(ctx, characterName, realm)
+		if err != nil {
+			return nil, err
+		}
+		facts.achievements = achievements
+	}
+	return facts, nil
+}
+
+// unmetConditions returns a description of every condition of the rule the character
+// does not meet; the rule matches when there are none
+func unmetConditions(rule config.RoleRule, facts *ruleFacts) []string {
+	var unmet []string
+	if rule.MinLevel > 0 && facts.level < rule.MinLevel {
+		unmet = append(unmet, fmt.Sprintf("level %d is below %d", facts.level, rule.MinLevel))
+	}
+	if rule.Faction != "" && !strings.EqualFold(facts.faction, rule.Faction) {
+		faction := strings.ToLower(facts.faction)
+		if faction == "" {
+			faction = "unknown"
+		}
+		unmet = append(unmet, fmt.Sprintf("faction is %s, not %s", faction, strings.ToLower(rule.Faction)))
+	}
+	if len(rule.Classes) > 0 {
+		found := false
+		// Class names are matched by ID, as the API returns them in the region's locale
+		for _, class := range rule.Classes {
+			if id, ok := blizzard.ClassID(class); ok && id == facts.classID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmet = append(unmet, fmt.Sprintf("class %s is not one of %s", facts.class, strings.Join(rule.Classes, ", ")))
+		}
+	}
+	if rule.MinMythicRating > 0 && facts.rating < rule.MinMythicRating {
+		unmet = append(unmet, fmt.Sprintf("Mythic+ rating %.0f is below %.0f", facts.rating, rule.MinMythicRating))
+	}
+	for _, id := range rule.Achievements {
+		if facts.achievements == nil || !facts.achievements.Completed(id) {
+			unmet = append(unmet, fmt.Sprintf("achievement %d is not completed", id))
+		}
+	}
+	switch {
+	case (rule.InGuild || rule.MaxGuildRank != nil) && !facts.inGuild:
+		unmet = append(unmet, "not in a tracked guild")
+	case rule.MaxGuildRank != nil && facts.rank < 0:
+		unmet = append(unmet, "guild rank is unknown")
+	case rule.MaxGuildRank != nil && facts.rank > *rule.MaxGuildRank:
+		unmet = append(unmet, fmt.Sprintf("guild rank %d is lower than rank %d", facts.rank, *rule.MaxGuildRank))
+	}
+	return unmet
+}
+
+// rankUnknown reports whether the rule depends on the guild rank of a guild member whose
+// rank could not be determined, in which case its role is neither granted nor revoked
+func rankUnknown(rule config.RoleRule, facts *ruleFacts) bool {
+	return rule.MaxGuildRank != nil && facts.inGuild && facts.rank < 0
+}
+
+// applyRoleRules grants the roles of matching rules and revokes the roles of rules that
+// no longer match. A role shared by several rules is kept while any of them matches, and
+// roles of rules that depend on an unknown guild rank are left as they are. It returns
+// the names of the rules whose roles were granted and removed.
+func applyRoleRules(s DiscordSession, guildID string, member *discordgo.Member, facts *ruleFacts) ([]string, []string, error) {
+	matched := make(map[string]string) // role ID -> name of the first matching rule
+	undecided := make(map[string]bool)
+	for _, rule := range cfg.RoleRules {
+		if rankUnknown(rule, facts) {
+			undecided[rule.RoleID] = true
+			continue
+		}
+		if _, ok := matched[rule.RoleID]; !ok && len(unmetConditions(rule, facts)) == 0 {
+			matched[rule.RoleID] = rule.Name
+		}
+	}
+
+	var granted, removed []string
+	seen := make(map[string]bool)
+	for _, rule := range cfg.RoleRules {
+		if seen[rule.RoleID] {
+			continue
+		}
+		seen[rule.RoleID] = true
+
+		hasRole := hasAnyRole(member, []string{rule.RoleID})
+		name, shouldHave := matched[rule.RoleID]
+		switch {
+		case shouldHave && !hasRole:
+			if util.IsDebugEnabled() {
+				util.Logger.Printf("Adding %s role to user %s", name, member.User.Username)
+			}
+			if err := s.GuildMemberRoleAdd(guildID, member.User.ID, rule.RoleID); err != nil {
+				return granted, removed, fmt.Errorf("failed to add %s role: %v", name, err)
+			}
+			granted = append(granted, name)
+		case !shouldHave && hasRole && !undecided[rule.RoleID]:
+			if util.IsDebugEnabled() {
+				util.Logger.Printf("Removing %s role from user %s", rule.Name, member.User.Username)
+			}
+			if err := s.GuildMemberRoleRemove(guildID, member.User.ID, rule.RoleID); err != nil {
+				return granted, removed, fmt.Errorf("failed to remove %s role: %v", rule.Name, err)
+			}
+			removed = append(removed, rule.Name)
+		}
+	}
+	return granted, removed, nil
+}
+
+// handleCheckRules shows which role rules a user's registered character matches,
+// without changing any roles
+func handleCheckRules(c *commandContext) {
+	ctx := c.ctx
+	if len(cfg.RoleRules) == 0 {
+		c.reply("No role rules are configured")
+		return
+	}
+
+	username := c.params["discord_username"]
+	reg, err := database.GetCharacter(db, username)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if reg == nil {
+		c.reply(fmt.Sprintf("No registration found for %s", username))
+		return
+	}
+
+	guild, _, err := trackedGuildOf(ctx, reg.CharacterName, reg.Server)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error checking guild membership: %s", describeBlizzardError(err)))
+		return
+	}
+	rank := -1
+	if guild != nil {
+		rank = guildRank(ctx, reg.CharacterName, reg.Server)
+	}
+	facts, err := loadRuleFacts(ctx, reg.CharacterName, reg.Server, guild != nil, rank)
+	if err != nil {
+		c.reply(fmt.Sprintf("Error loading character data: %s", describeBlizzardError(err)))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(fmt.Sprintf("Role rules for %s (%s on %s):", username, reg.CharacterName, reg.Server))
+	for _, rule := range cfg.RoleRules {
+		if unmet := unmetConditions(rule, facts); len(unmet) > 0 {
+			line := fmt.Sprintf("\n- %s: does not match (%s)", rule.Name, strings.Join(unmet, "; "))
+			if rankUnknown(rule, facts) {
+				line += ", role left unchanged"
+			}
+			response.WriteString(line)
+		} else {
+			response.WriteString(fmt.Sprintf("\n- %s: matches", rule.Name))
+		}
+	}
+	c.reply(response.String())
+}
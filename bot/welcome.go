@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	database "github.com/bezerker/sndbot/database"
+	util "github.com/bezerker/sndbot/util"
+	"github.com/bwmarrin/discordgo"
+)
+
+// welcomeTimeout bounds the Blizzard API calls made when restoring a returning member's roles
+const welcomeTimeout = 30 * time.Second
+
+// defaultWelcomeMessage is posted to the welcome channel when WELCOME_MESSAGE is not set
+const defaultWelcomeMessage = "Welcome to {server}, {user}!"
+
+// handleMemberJoin welcomes a new member of the Discord server. Members with a
+// registration get their roles back, everyone else is sent registration instructions.
+func handleMemberJoin(s DiscordSession, m *discordgo.GuildMemberAdd) {
+	if m.Member == nil || m.User == nil || m.User.Bot {
+		return
+	}
+	if cfg.DiscordGuildID != "" && m.GuildID != cfg.DiscordGuildID {
+		return
+	}
+	server := serverName(s, m.GuildID)
+
+	dm := fmt.Sprintf("Welcome to %s! To get your roles, register your World of Warcraft character in any channel of the server with !register <character> <realm> or /register. Send !help for more commands.", server)
+	reg, err := memberRegistration(m.User)
+	if err != nil {
+		util.Logger.Printf("Error getting registration of new member %s: %v", m.User.Username, err)
+	}
+	if reg != nil {
+		markRejoined(reg, m.User.ID)
+		dm = restoreMemberRoles(s, m.GuildID, reg, m.User.ID, server)
+	}
+
+	channel, err := s.UserChannelCreate(m.User.ID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(channel.ID, dm)
+	}
+	if err != nil {
+		// Members may not accept direct messages from server members
+		util.Logger.Printf("Error sending welcome message to %s: %v", m.User.Username, err)
+	}
+
+	if cfg.WelcomeChannelID == "" {
+		return
+	}
+	if _, err := s.ChannelMessageSend(cfg.WelcomeChannelID, welcomeMessage(m.User, server)); err != nil {
+		util.Logger.Printf("Error posting welcome message for %s: %v", m.User.Username, err)
+	}
+}
+
+// memberRegistration returns the registration of a Discord user. It is looked up by user
+// ID, so members who changed their username are still found, and by username only for
+// registrations that predate stored user IDs.
+func memberRegistration(user *discordgo.User) (*database.CharacterRegistration, error) {
+	reg, err := database.GetCharacterByUserID(db, user.ID)
+	if err != nil || reg != nil {
+		return reg, err
+	}
+	reg, err = database.GetCharacter(db, user.Username)
+	// A stored user ID that differs means the username belongs to someone else
+	if err != nil || reg == nil || reg.DiscordUserID != "" {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// restoreMemberRoles re-verifies a returning member's registered character and grants
+// the roles it qualifies for, returning the direct message describing the outcome
+func restoreMemberRoles(s DiscordSession, guildID string, reg *database.CharacterRegistration, userID, server string) string {
+	if reg.DiscordUserID == "" {
+		if err := database.SetDiscordUserID(db, reg.DiscordUsername, userID); err != nil {
+			util.Logger.Printf("Error storing Discord user ID of %s: %v", reg.DiscordUsername, err)
+		}
+		reg.DiscordUserID = userID
+	}
+
+	ctx, cancel := context.WithTimeout(botCtx, welcomeTimeout)
+	defer cancel()
+	summary := &reconcileSummary{checked: 1}
+	reconcileRegistration(ctx, s, guildID, *reg, summary)
+	for _, line := range append(summary.failed, summary.skipped...) {
+		util.Logger.Printf("Restoring roles of returning member: %s", strings.TrimPrefix(line, "- "))
+	}
+
+	if len(summary.failed) > 0 || len(summary.skipped) > 0 {
+		return fmt.Sprintf("Welcome back to %s! Your character %s on %s is still registered, but your roles could not be restored right now. Please run !register again in the server to get them back.", server, reg.CharacterName, reg.Server)
+	}
+	return fmt.Sprintf("Welcome back to %s! Your character %s on %s is still registered and your roles have been restored.", server, reg.CharacterName, reg.Server)
+}
+
+// welcomeMessage fills in the WELCOME_MESSAGE template. {user} mentions the new
+// member, {username} is their plain username and {server} the Discord server's name.
+func welcomeMessage(user *discordgo.User, server string) string {
+	template := cfg.WelcomeMessage
+	if template == "" {
+		template = defaultWelcomeMessage
+	}
+	return strings.NewReplacer(
+		"{user}", user.Mention(),
+		"{username}", user.Username,
+		"{server}", server,
+	).Replace(template)
+}
+
+// serverName returns the name of a Discord server from the state cache, or a generic
+// description when it is not cached
+func serverName(s DiscordSession, guildID string) string {
+	if state := s.GetState(); state != nil {
+		if guild, err := state.Guild(guildID); err == nil && guild.Name != "" {
+			return guild.Name
+		}
+	}
+	return "the server"
+}
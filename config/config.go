@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,9 +13,92 @@ type Config struct {
 	DiscordToken       string   `mapstructure:"DISCORD_TOKEN"`
 	BlizzardClientID   string   `mapstructure:"BLIZZARD_CLIENT_ID"`
 	BlizzardSecret     string   `mapstructure:"BLIZZARD_SECRET"`
+	BlizzardRegion     string   `mapstructure:"BLIZZARD_REGION"`   // us, eu, kr or tw; defaults to us
+	BlizzardLocale     string   `mapstructure:"BLIZZARD_LOCALE"`   // optional override of the region's default locale
+	PersistAPICache    bool     `mapstructure:"PERSIST_API_CACHE"` // keep cached Blizzard responses in the database across restarts
 	DBPath             string   `mapstructure:"DB_PATH"`
 	CommunityRoleID    string   `mapstructure:"COMMUNITY_ROLE_ID"`
 	GuildMemberRoleIDs []string `mapstructure:"GUILD_MEMBER_ROLE_IDS"`
+	// GuildRankRoleIDs maps in-game guild rank indexes (0 is the guild master) to Discord
+	// role IDs, e.g. {"0": "officer-role", "1": "officer-role", "4": "raider-role"}
+	GuildRankRoleIDs  map[int]string `mapstructure:"-"`
+	DiscordGuildID    string         `mapstructure:"DISCORD_GUILD_ID"`   // Discord server whose roles are reconciled
+	AdminChannelID    string         `mapstructure:"ADMIN_CHANNEL_ID"`   // channel that receives reconciliation summaries
+	ReconcileInterval time.Duration  `mapstructure:"RECONCILE_INTERVAL"` // e.g. 6h; empty disables periodic role reconciliation
+	// TrackedGuilds are the WoW guilds whose members are verified and given guild roles,
+	// parsed from the TRACKED_GUILDS JSON array. Use Guilds, which falls back to the
+	// legacy single guild when none are configured.
+	TrackedGuilds []TrackedGuild `mapstructure:"-"`
+	// RoleRules grant roles based on character data, parsed from the ROLE_RULES JSON array
+	RoleRules []RoleRule `mapstructure:"-"`
+	// SyncNicknames sets members' server nicknames to their registered character on
+	// registration and reconciliation, with the realm appended when NicknameIncludeRealm is set
+	SyncNicknames        bool `mapstructure:"SYNC_NICKNAMES"`
+	NicknameIncludeRealm bool `mapstructure:"NICKNAME_INCLUDE_REALM"`
+	// WelcomeChannelID receives a welcome message when someone joins the server, using
+	// the WelcomeMessage template with {user}, {username} and {server} placeholders
+	WelcomeChannelID string `mapstructure:"WELCOME_CHANNEL_ID"`
+	WelcomeMessage   string `mapstructure:"WELCOME_MESSAGE"`
+	// DepartedGracePeriod is how long the registration of a user who left the server is
+	// kept before it is deleted, e.g. 720h; empty keeps it until an admin purges it
+	DepartedGracePeriod time.Duration `mapstructure:"DEPARTED_GRACE_PERIOD"`
+}
+
+// TrackedGuild is a WoW guild whose members get guild roles, for example
+// {"name": "Stand and Deliver", "realm": "Cenarius", "member_role_ids": ["123"], "rank_role_ids": {"0": "456"}}
+type TrackedGuild struct {
+	Name  string `json:"name"`
+	Realm string `json:"realm"` // realm name or slug
+	// ID identifies the guild exactly; when 0 the guild is matched by name and realm
+	ID int `json:"id,omitempty"`
+	// MemberRoleIDs are the guild's member roles; the first is granted to members whose
+	// rank has no role in RankRoleIDs
+	MemberRoleIDs []string `json:"member_role_ids,omitempty"`
+	// RankRoleIDs maps in-game rank indexes (0 is the guild master) to role IDs
+	RankRoleIDs map[int]string `json:"rank_role_ids,omitempty"`
+}
+
+// Guilds returns the tracked guilds. Without TRACKED_GUILDS the bot tracks Stand and
+// Deliver on Cenarius with GUILD_MEMBER_ROLE_IDS and GUILD_RANK_ROLE_IDS, as it did
+// before guilds were configurable.
+func (c Config) Guilds() []TrackedGuild {
+	if len(c.TrackedGuilds) > 0 {
+		return c.TrackedGuilds
+	}
+	return []TrackedGuild{{
+		Name:          "Stand and Deliver",
+		Realm:         "Cenarius",
+		ID:            70395110,
+		MemberRoleIDs: c.GuildMemberRoleIDs,
+		RankRoleIDs:   c.GuildRankRoleIDs,
+	}}
+}
+
+// RoleRule grants a Discord role to members whose registered character meets every
+// condition that is set, and revokes it from members whose character no longer does.
+// For example {"name": "KSM", "role_id": "123", "min_mythic_rating": 2000}.
+type RoleRule struct {
+	Name            string   `json:"name"`
+	RoleID          string   `json:"role_id"`
+	MinLevel        int      `json:"min_level,omitempty"`
+	Faction         string   `json:"faction,omitempty"` // alliance or horde
+	Classes         []string `json:"classes,omitempty"` // any of these English class names
+	MinMythicRating float64  `json:"min_mythic_rating,omitempty"`
+	Achievements    []int    `json:"achievements,omitempty"` // all of these achievement IDs
+	InGuild         bool     `json:"in_guild,omitempty"`
+	// MaxGuildRank requires guild membership at this rank index or better (0 is the guild master)
+	MaxGuildRank *int `json:"max_guild_rank,omitempty"`
+}
+
+// validate checks that the rule names a role and uses known values
+func (r RoleRule) validate() error {
+	if r.Name == "" || r.RoleID == "" {
+		return fmt.Errorf("every rule needs a name and a role_id")
+	}
+	if r.Faction != "" && !strings.EqualFold(r.Faction, "alliance") && !strings.EqualFold(r.Faction, "horde") {
+		return fmt.Errorf("rule %s: faction must be alliance or horde, got %q", r.Name, r.Faction)
+	}
+	return nil
 }
 
 func LoadConfig() (config Config, err error) {
@@ -45,5 +130,48 @@ func LoadConfig() (config Config, err error) {
 		config.GuildMemberRoleIDs = roleIDs
 	}
 
+	// Handle the JSON object mapping guild ranks to role IDs
+	rankRolesStr := viper.GetString("GUILD_RANK_ROLE_IDS")
+	if rankRolesStr != "" {
+		var rankRoles map[int]string
+		err = json.Unmarshal([]byte(rankRolesStr), &rankRoles)
+		if err != nil {
+			return config, fmt.Errorf("failed to parse GUILD_RANK_ROLE_IDS: %v", err)
+		}
+		config.GuildRankRoleIDs = rankRoles
+	}
+
+	// Handle the JSON array of tracked guilds
+	trackedGuildsStr := viper.GetString("TRACKED_GUILDS")
+	if trackedGuildsStr != "" {
+		var guilds []TrackedGuild
+		err = json.Unmarshal([]byte(trackedGuildsStr), &guilds)
+		if err != nil {
+			return config, fmt.Errorf("failed to parse TRACKED_GUILDS: %v", err)
+		}
+		for _, guild := range guilds {
+			if guild.Name == "" || guild.Realm == "" {
+				return config, fmt.Errorf("invalid TRACKED_GUILDS: every guild needs a name and a realm")
+			}
+		}
+		config.TrackedGuilds = guilds
+	}
+
+	// Handle the JSON array of role rules
+	roleRulesStr := viper.GetString("ROLE_RULES")
+	if roleRulesStr != "" {
+		var rules []RoleRule
+		err = json.Unmarshal([]byte(roleRulesStr), &rules)
+		if err != nil {
+			return config, fmt.Errorf("failed to parse ROLE_RULES: %v", err)
+		}
+		for _, rule := range rules {
+			if err = rule.validate(); err != nil {
+				return config, fmt.Errorf("invalid ROLE_RULES: %v", err)
+			}
+		}
+		config.RoleRules = rules
+	}
+
 	return
 }
@@ -2,14 +2,38 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type CharacterRegistration struct {
 	DiscordUsername string
-	CharacterName   string
-	Server          string
+	// DiscordUserID is empty for registrations made before user IDs were stored, or made
+	// by an admin on behalf of a user
+	DiscordUserID string
+	CharacterName string
+	Server        string
+	// LeftAt is when the user left the Discord server, zero while they are a member
+	LeftAt time.Time
+}
+
+// AuditEntry is a recorded membership event, such as a registered user leaving the server
+type AuditEntry struct {
+	CreatedAt       time.Time
+	Event           string
+	DiscordUsername string
+	DiscordUserID   string
+	Details         string
+}
+
+// APICacheEntry is a persisted Blizzard API response
+type APICacheEntry struct {
+	CacheKey     string
+	Body         []byte
+	LastModified string
+	ExpiresAt    time.Time
 }
 
 func InitDB(dbPath string) (*sql.DB, error) {
@@ -31,6 +55,18 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Discord user IDs were added after the characters table was first released
+	err = addColumnIfMissing(db, "characters", "discord_user_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return nil, err
+	}
+
+	// Registrations of users who left the server are kept until purged
+	err = addColumnIfMissing(db, "characters", "left_at", "DATETIME")
+	if err != nil {
+		return nil, err
+	}
+
 	// Create admins table
 	createAdminTableSQL := `
 	CREATE TABLE IF NOT EXISTS admins (
@@ -42,24 +78,111 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Create API response cache table
+	createAPICacheTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_cache (
+		cache_key TEXT PRIMARY KEY,
+		body BLOB NOT NULL,
+		last_modified TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL
+	);`
+
+	_, err = db.Exec(createAPICacheTableSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create audit log table
+	createAuditLogTableSQL := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		event TEXT NOT NULL,
+		discord_username TEXT NOT NULL,
+		discord_user_id TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT ''
+	);`
+
+	_, err = db.Exec(createAuditLogTableSQL)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// addColumnIfMissing adds a column to an existing table, for databases created by
+// older versions of the bot
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func RegisterCharacter(db *sql.DB, registration CharacterRegistration) error {
-	// Using REPLACE to handle updates of existing registrations
+	// Upsert to handle updates of existing registrations; a known user ID is kept when
+	// an admin re-registers the user without one, and the registration becomes active again
 	stmt := `
-	REPLACE INTO characters (discord_username, character_name, server)
-	VALUES (?, ?, ?)`
+	INSERT INTO characters (discord_username, discord_user_id, character_name, server)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(discord_username) DO UPDATE SET
+		left_at = NULL,
+		character_name = excluded.character_name,
+		server = excluded.server,
+		discord_user_id = CASE WHEN excluded.discord_user_id != '' THEN excluded.discord_user_id ELSE characters.discord_user_id END`
 
-	_, err := db.Exec(stmt, registration.DiscordUsername, registration.CharacterName, registration.Server)
+	_, err := db.Exec(stmt, registration.DiscordUsername, registration.DiscordUserID, registration.CharacterName, registration.Server)
+	return err
+}
+
+// SetDiscordUserID records the Discord user ID of a registration
+func SetDiscordUserID(db *sql.DB, discordUsername, discordUserID string) error {
+	_, err := db.Exec("UPDATE characters SET discord_user_id = ? WHERE discord_username = ?", discordUserID, discordUsername)
 	return err
 }
 
 func GetCharacter(db *sql.DB, discordUsername string) (*CharacterRegistration, error) {
-	stmt := `SELECT discord_username, character_name, server FROM characters WHERE discord_username = ?`
+	stmt := `SELECT discord_username, discord_user_id, character_name, server, left_at FROM characters WHERE discord_username = ?`
 
-	registration := &CharacterRegistration{}
-	err := db.QueryRow(stmt, discordUsername).Scan(&registration.DiscordUsername, &registration.CharacterName, &registration.Server)
+	registration, err := scanRegistration(db.QueryRow(stmt, discordUsername))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+// GetCharacterByUserID returns the registration of a Discord user ID, preferring an
+// active one if the user registered under several usernames
+func GetCharacterByUserID(db *sql.DB, discordUserID string) (*CharacterRegistration, error) {
+	stmt := `SELECT discord_username, discord_user_id, character_name, server, left_at FROM characters
+	WHERE discord_user_id = ? ORDER BY left_at IS NOT NULL, left_at DESC LIMIT 1`
+
+	registration, err := scanRegistration(db.QueryRow(stmt, discordUserID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -94,7 +217,61 @@ func RemoveCharacterRegistration(db *sql.DB, discordUsername string) error {
 }
 
 func GetAllRegistrations(db *sql.DB) ([]CharacterRegistration, error) {
-	rows, err := db.Query("SELECT discord_username, character_name, server FROM characters")
+	return queryRegistrations(db, "SELECT discord_username, discord_user_id, character_name, server, left_at FROM characters")
+}
+
+// GetDepartedRegistrations returns the registrations of users who left the Discord
+// server, longest gone first
+func GetDepartedRegistrations(db *sql.DB) ([]CharacterRegistration, error) {
+	return queryRegistrations(db, "SELECT discord_username, discord_user_id, character_name, server, left_at FROM characters WHERE left_at IS NOT NULL ORDER BY left_at")
+}
+
+// MarkRegistrationLeft records that the user of a registration left the Discord server
+func MarkRegistrationLeft(db *sql.DB, discordUsername string, leftAt time.Time) error {
+	_, err := db.Exec("UPDATE characters SET left_at = ? WHERE discord_username = ?", leftAt.UTC(), discordUsername)
+	return err
+}
+
+// MarkRegistrationActive clears the departure of a user who rejoined the Discord server
+func MarkRegistrationActive(db *sql.DB, discordUsername string) error {
+	_, err := db.Exec("UPDATE characters SET left_at = NULL WHERE discord_username = ?", discordUsername)
+	return err
+}
+
+// PurgeDepartedRegistration deletes a registration if its user left the Discord server
+// before the given time. It reports whether it was deleted, which it is not if the user
+// rejoined in the meantime.
+func PurgeDepartedRegistration(db *sql.DB, discordUsername string, leftBefore time.Time) (bool, error) {
+	result, err := db.Exec("DELETE FROM characters WHERE discord_username = ? AND left_at IS NOT NULL AND left_at < ?", discordUsername, leftBefore.UTC())
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRegistration(row rowScanner) (*CharacterRegistration, error) {
+	var reg CharacterRegistration
+	var leftAt sql.NullTime
+	if err := row.Scan(&reg.DiscordUsername, &reg.DiscordUserID, &reg.CharacterName, &reg.Server, &leftAt); err != nil {
+		return nil, err
+	}
+	if leftAt.Valid {
+		reg.LeftAt = leftAt.Time
+	}
+	return &reg, nil
+}
+
+func queryRegistrations(db *sql.DB, query string) ([]CharacterRegistration, error) {
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -102,12 +279,53 @@ func GetAllRegistrations(db *sql.DB) ([]CharacterRegistration, error) {
 
 	var registrations []CharacterRegistration
 	for rows.Next() {
-		var reg CharacterRegistration
-		err := rows.Scan(&reg.DiscordUsername, &reg.CharacterName, &reg.Server)
+		reg, err := scanRegistration(rows)
 		if err != nil {
 			return nil, err
 		}
-		registrations = append(registrations, reg)
+		registrations = append(registrations, *reg)
+	}
+	return registrations, rows.Err()
+}
+
+// AddAuditEntry records a membership event; CreatedAt defaults to now
+func AddAuditEntry(db *sql.DB, entry AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	stmt := `
+	INSERT INTO audit_log (created_at, event, discord_username, discord_user_id, details)
+	VALUES (?, ?, ?, ?, ?)`
+
+	_, err := db.Exec(stmt, entry.CreatedAt.UTC(), entry.Event, entry.DiscordUsername, entry.DiscordUserID, entry.Details)
+	return err
+}
+
+func GetAPICacheEntry(db *sql.DB, cacheKey string) (*APICacheEntry, error) {
+	stmt := `SELECT cache_key, body, last_modified, expires_at FROM api_cache WHERE cache_key = ?`
+
+	entry := &APICacheEntry{}
+	err := db.QueryRow(stmt, cacheKey).Scan(&entry.CacheKey, &entry.Body, &entry.LastModified, &entry.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return registrations, nil
+	return entry, nil
+}
+
+func SaveAPICacheEntry(db *sql.DB, entry APICacheEntry) error {
+	stmt := `
+	REPLACE INTO api_cache (cache_key, body, last_modified, expires_at)
+	VALUES (?, ?, ?, ?)`
+
+	_, err := db.Exec(stmt, entry.CacheKey, entry.Body, entry.LastModified, entry.ExpiresAt.UTC())
+	return err
+}
+
+// PurgeAPICache removes cached responses that expired before the given time
+func PurgeAPICache(db *sql.DB, expiredBefore time.Time) error {
+	_, err := db.Exec("DELETE FROM api_cache WHERE expires_at < ?", expiredBefore.UTC())
+	return err
 }